@@ -0,0 +1,127 @@
+package actor
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hechh/library/async"
+)
+
+// 监督策略
+const (
+	SUPERVISE_RESUME  = 0 // 忽略panic, 保留状态继续处理
+	SUPERVISE_RESTART = 1 // 通过工厂重建状态
+	SUPERVISE_STOP    = 2 // 停止并回收actor
+)
+
+// 监督配置
+type Supervisor struct {
+	Strategy   int32         // 监督策略
+	MaxRestart int           // Window内最大重启次数, 超过则停止, <=0不限制
+	Window     time.Duration // 重启次数统计窗口
+}
+
+// actor停止时回调(在actor自身协程上执行)
+type IStop interface {
+	OnStop()
+}
+
+type Actor[T any] struct {
+	once     sync.Once
+	system   *System[T]
+	async    *async.Async
+	state    T
+	active   int64       // 最后活跃时间(毫秒)
+	restarts []time.Time // 窗口内的重启时间
+	stopped  bool        // 停止后拒绝处理剩余消息
+}
+
+func newActor[T any](s *System[T], id uint64, state T) *Actor[T] {
+	ret := &Actor[T]{
+		system: s,
+		async:  async.NewAsync(),
+		state:  state,
+		active: time.Now().UnixMilli(),
+	}
+	ret.async.SetId(id)
+	ret.async.Start()
+	return ret
+}
+
+func (d *Actor[T]) GetId() uint64 {
+	return d.async.GetId()
+}
+
+// 最后活跃时间(毫秒)
+func (d *Actor[T]) GetActive() int64 {
+	return atomic.LoadInt64(&d.active)
+}
+
+func (d *Actor[T]) isIdle(nowMs int64, idle time.Duration) bool {
+	return d.async.GetCount() <= 0 && nowMs-atomic.LoadInt64(&d.active) >= idle.Milliseconds()
+}
+
+func (d *Actor[T]) push(f func(T), fail func(error)) error {
+	atomic.StoreInt64(&d.active, time.Now().UnixMilli())
+	return d.async.PushContext(context.Background(), func() {
+		if d.stopped {
+			if fail != nil {
+				fail(ErrStopped)
+			}
+			return
+		}
+		if err := async.CatchId(d.GetId(), func() { f(d.state) }); err != nil {
+			if fail != nil {
+				fail(err)
+			}
+			d.supervise()
+		}
+	})
+}
+
+// panic后按策略处理, 在actor协程上执行
+func (d *Actor[T]) supervise() {
+	sup := d.system.sup
+	switch sup.Strategy {
+	case SUPERVISE_RESTART:
+		if sup.MaxRestart > 0 {
+			now := time.Now()
+			pos := 0
+			for pos < len(d.restarts) && now.Sub(d.restarts[pos]) > sup.Window {
+				pos++
+			}
+			d.restarts = append(d.restarts[pos:], now)
+			if len(d.restarts) > sup.MaxRestart {
+				d.stopped = true
+				d.system.remove(d)
+				return
+			}
+		}
+		state, err := d.system.factory(d.GetId())
+		if err != nil {
+			d.stopped = true
+			d.system.remove(d)
+			return
+		}
+		d.state = state
+	case SUPERVISE_STOP:
+		d.stopped = true
+		d.system.remove(d)
+	}
+}
+
+// 停止actor, 已入队的消息处理完后调用OnStop
+func (d *Actor[T]) stop() {
+	d.once.Do(func() {
+		d.async.Push(func() {
+			if vv, ok := any(d.state).(IStop); ok {
+				async.Recover(vv.OnStop)
+			}
+			d.stopped = true
+		})
+		d.async.Done()
+		d.async.Wait()
+	})
+}
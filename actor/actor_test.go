@@ -0,0 +1,67 @@
+package actor
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type player struct {
+	id    uint64
+	count int
+	stops *int32
+}
+
+func (d *player) OnStop() {
+	atomic.AddInt32(d.stops, 1)
+}
+
+func TestSystem(t *testing.T) {
+	stops := int32(0)
+	sys := NewSystem(func(id uint64) (*player, error) {
+		return &player{id: id, stops: &stops}, nil
+	}, 0, Supervisor{Strategy: SUPERVISE_RESTART})
+
+	for i := 0; i < 10; i++ {
+		sys.Tell(1, func(p *player) { p.count++ })
+	}
+	val, err := Ask(sys, 1, func(p *player) (int, error) { return p.count, nil }).Get(context.Background())
+	if err != nil || val != 10 {
+		t.Fatalf("val: %d, err: %v", val, err)
+	}
+
+	// panic后重建状态
+	if _, err := Ask(sys, 1, func(p *player) (int, error) { panic("boom") }).Get(context.Background()); err == nil {
+		t.Fatal("expect panic error")
+	}
+	val, _ = Ask(sys, 1, func(p *player) (int, error) { return p.count, nil }).Get(context.Background())
+	if val != 0 {
+		t.Fatalf("expect restarted state, got %d", val)
+	}
+
+	sys.Tell(2, func(p *player) {})
+	sys.Close()
+	if stops != 2 {
+		t.Fatalf("stops: %d", stops)
+	}
+	if err := sys.Tell(1, func(p *player) {}); err != ErrClosed {
+		t.Fatalf("expect ErrClosed, got %v", err)
+	}
+}
+
+func TestReclaim(t *testing.T) {
+	sys := NewSystem(func(id uint64) (*player, error) {
+		return &player{id: id, stops: new(int32)}, nil
+	}, 20*time.Millisecond, Supervisor{})
+	defer sys.Close()
+
+	sys.Tell(1, func(p *player) {})
+	if sys.Count() != 1 {
+		t.Fatalf("count: %d", sys.Count())
+	}
+	time.Sleep(100 * time.Millisecond)
+	if sys.Count() != 0 {
+		t.Fatalf("expect reclaimed, count: %d", sys.Count())
+	}
+}
@@ -0,0 +1,228 @@
+package actor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hechh/library/async"
+	"github.com/hechh/library/uerror"
+)
+
+var (
+	ErrClosed   = uerror.Err(-1, "actor系统已关闭")
+	ErrStopped  = uerror.Err(-1, "actor已停止")
+	ErrNotFound = uerror.Err(-1, "actor不存在")
+)
+
+type System[T any] struct {
+	mutex   sync.RWMutex
+	group   sync.WaitGroup
+	factory func(uint64) (T, error) // 创建actor状态
+	sup     Supervisor              // 监督配置
+	idle    time.Duration           // 空闲回收时间, <=0不回收
+	actors  map[uint64]*Actor[T]
+	exit    chan struct{}
+	closed  bool
+}
+
+// factory创建actor状态, idle为空闲回收时间(<=0不回收)
+func NewSystem[T any](factory func(uint64) (T, error), idle time.Duration, sup Supervisor) *System[T] {
+	ret := &System[T]{
+		factory: factory,
+		sup:     sup,
+		idle:    idle,
+		actors:  make(map[uint64]*Actor[T]),
+		exit:    make(chan struct{}),
+	}
+	if idle > 0 {
+		ret.group.Add(1)
+		go ret.run()
+	}
+	return ret
+}
+
+// actor数量
+func (d *System[T]) Count() int {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return len(d.actors)
+}
+
+func (d *System[T]) Get(id uint64) *Actor[T] {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.actors[id]
+}
+
+// 创建actor, 已存在则直接返回
+func (d *System[T]) Spawn(id uint64) (*Actor[T], error) {
+	if act := d.Get(id); act != nil {
+		return act, nil
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.spawn(id)
+}
+
+func (d *System[T]) spawn(id uint64) (*Actor[T], error) {
+	if d.closed {
+		return nil, ErrClosed
+	}
+	if act, ok := d.actors[id]; ok {
+		return act, nil
+	}
+	state, err := d.factory(id)
+	if err != nil {
+		return nil, err
+	}
+	act := newActor(d, id, state)
+	d.actors[id] = act
+	return act, nil
+}
+
+// 投递消息, actor不存在时自动创建
+func (d *System[T]) Tell(id uint64, f func(T)) error {
+	return d.send(id, f, nil)
+}
+
+// 投递消息, actor不存在时返回ErrNotFound
+func (d *System[T]) TellExist(id uint64, f func(T)) error {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	if d.closed {
+		return ErrClosed
+	}
+	act, ok := d.actors[id]
+	if !ok {
+		return ErrNotFound
+	}
+	return act.push(f, nil)
+}
+
+// 请求响应, 结果通过Future返回, actor内部请其他actor时应使用Future.Then回到自身
+func Ask[T, R any](d *System[T], id uint64, f func(T) (R, error)) *async.Future[R] {
+	ret := async.NewFuture[R]()
+	err := d.send(id, func(state T) {
+		val, err := f(state)
+		ret.Resolve(val, err)
+	}, func(err error) {
+		var zero R
+		ret.Resolve(zero, err)
+	})
+	if err != nil {
+		var zero R
+		ret.Resolve(zero, err)
+	}
+	return ret
+}
+
+// 入队在读锁内完成, 保证回收时不会丢消息
+func (d *System[T]) send(id uint64, f func(T), fail func(error)) error {
+	d.mutex.RLock()
+	if d.closed {
+		d.mutex.RUnlock()
+		return ErrClosed
+	}
+	if act, ok := d.actors[id]; ok {
+		defer d.mutex.RUnlock()
+		return act.push(f, fail)
+	}
+	d.mutex.RUnlock()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	act, err := d.spawn(id)
+	if err != nil {
+		return err
+	}
+	return act.push(f, fail)
+}
+
+// 停止actor, 已入队的消息处理完后返回
+func (d *System[T]) Stop(id uint64) {
+	d.mutex.Lock()
+	act, ok := d.actors[id]
+	if ok {
+		delete(d.actors, id)
+	}
+	d.mutex.Unlock()
+	if ok {
+		act.stop()
+	}
+}
+
+// 从actor协程内部移除, 异步停止避免自身等待
+func (d *System[T]) remove(act *Actor[T]) {
+	d.mutex.Lock()
+	if d.actors[act.GetId()] == act {
+		delete(d.actors, act.GetId())
+	}
+	d.mutex.Unlock()
+	d.group.Add(1)
+	async.Go(func() {
+		defer d.group.Done()
+		act.stop()
+	})
+}
+
+// 关闭系统, 拒绝新消息并等待所有mailbox处理完毕
+func (d *System[T]) Close() {
+	d.mutex.Lock()
+	if d.closed {
+		d.mutex.Unlock()
+		return
+	}
+	d.closed = true
+	acts := d.actors
+	d.actors = make(map[uint64]*Actor[T])
+	d.mutex.Unlock()
+
+	close(d.exit)
+	wg := sync.WaitGroup{}
+	for _, act := range acts {
+		wg.Add(1)
+		async.Go(func() {
+			defer wg.Done()
+			act.stop()
+		})
+	}
+	wg.Wait()
+	d.group.Wait()
+}
+
+func (d *System[T]) run() {
+	interval := time.Second
+	if d.idle < interval {
+		interval = d.idle
+	}
+	tt := time.NewTicker(interval)
+	defer func() {
+		tt.Stop()
+		d.group.Done()
+	}()
+	for {
+		select {
+		case <-tt.C:
+			d.reclaim()
+		case <-d.exit:
+			return
+		}
+	}
+}
+
+// 回收空闲actor
+func (d *System[T]) reclaim() {
+	nowMs := time.Now().UnixMilli()
+	acts := []*Actor[T]{}
+	d.mutex.Lock()
+	for id, act := range d.actors {
+		if act.isIdle(nowMs, d.idle) {
+			delete(d.actors, id)
+			acts = append(acts, act)
+		}
+	}
+	d.mutex.Unlock()
+	for _, act := range acts {
+		act.stop()
+	}
+}
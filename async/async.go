@@ -1,25 +1,39 @@
 package async
 
 import (
+	"context"
+	"runtime"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 type Async struct {
-	once   sync.Once
-	group  sync.WaitGroup
-	queue  *Queue[func()] // 任务队列
-	notify chan struct{}  // 通知
-	exit   chan struct{}  // 退出
-	id     uint64         // 唯一id
-	status int32          // 状态
+	once     sync.Once
+	exitOnce sync.Once // 关闭exit
+	overOnce sync.Once // 等待结束
+	group    sync.WaitGroup
+	lanes    *lanes        // 任务队列
+	bound    *bound        // 有界模式, nil为无界
+	stats    *Stats        // 运行统计, nil为不统计
+	notify   chan struct{} // 通知
+	exit     chan struct{} // 退出
+	over     chan struct{} // 全部结束
+	id       uint64        // 唯一id
+	status   int32         // 状态
+	abort    int32         // 放弃剩余任务
+	losts    int32         // 放弃的任务数
+	abandon  sync.Once     // 到期时统计放弃的任务
+	abandons int32         // 到期时已放弃和仍在排队的任务数
+	pushing  int32         // 正在入队的调用数
 }
 
 func NewAsync() *Async {
 	return &Async{
-		queue:  NewQueue[func()](),
+		lanes:  newLanes(0),
 		notify: make(chan struct{}, 1),
 		exit:   make(chan struct{}),
+		over:   make(chan struct{}),
 	}
 }
 
@@ -35,6 +49,22 @@ func (d *Async) SetId(id uint64) {
 	atomic.StoreUint64(&d.id, id)
 }
 
+// 待处理任务数
+func (d *Async) GetCount() int32 {
+	return d.lanes.GetCount()
+}
+
+// 各优先级通道待处理任务数
+func (d *Async) GetLaneCounts() []int32 {
+	return d.lanes.GetCounts()
+}
+
+// 设置优先级通道(需在Start之前调用)
+// weights为各通道每轮最多连续执行的任务数, 编号越小优先级越高, normal为Push默认使用的通道
+func (d *Async) SetLanes(normal int, weights ...int) {
+	d.lanes = newLanes(normal, weights...)
+}
+
 func (d *Async) Start() {
 	if atomic.CompareAndSwapInt32(&d.status, 0, 1) {
 		d.once.Do(func() {
@@ -48,38 +78,161 @@ func (d *Async) Stop() {
 	atomic.CompareAndSwapInt32(&d.status, 1, 0)
 }
 
+// 绑定父ctx启动, ctx取消后停止接收任务并处理完剩余任务
+func (d *Async) StartContext(ctx context.Context) {
+	d.Start()
+	context.AfterFunc(ctx, d.Done)
+}
+
+// 停止接收任务, 可重复调用
 func (d *Async) Done() {
-	atomic.StoreInt32(&d.status, 0)
-	close(d.exit)
+	d.exitOnce.Do(func() {
+		atomic.StoreInt32(&d.status, 0)
+		close(d.exit)
+	})
+}
+
+// 停止接收任务并处理剩余任务, ctx到期后立即返回, 未开始的任务在后台放弃(不会中断正在执行的任务)
+// 返回放弃的任务数(到期时仍在排队的任务), 可并发重复调用
+func (d *Async) Shutdown(ctx context.Context) (int, error) {
+	d.Done()
+	go d.Wait()
+	select {
+	case <-d.over:
+		return int(atomic.LoadInt32(&d.losts)), nil
+	case <-ctx.Done():
+		d.abandon.Do(func() {
+			atomic.StoreInt32(&d.abort, 1)
+			atomic.StoreInt32(&d.abandons, atomic.LoadInt32(&d.losts)+d.lanes.GetCount())
+		})
+		return int(atomic.LoadInt32(&d.abandons)), ctx.Err()
+	}
 }
 
+// 执行任务, 放弃模式下只计数并通知任务已被丢弃
+func (d *Async) exec(t task) {
+	if atomic.LoadInt32(&d.abort) > 0 {
+		atomic.AddInt32(&d.losts, 1)
+		t.discard(ErrStopped)
+		return
+	}
+	CatchId(d.GetId(), t.f)
+}
+
+// 等待所有任务结束, 需先调用Done
 func (d *Async) Wait() {
-	atomic.StoreUint64(&d.id, 0)
-	d.group.Wait()
+	d.overOnce.Do(func() {
+		d.group.Wait()
+		d.discard()
+		// 剩余任务处理完后再清零, 处理期间的panic仍记录id
+		atomic.StoreUint64(&d.id, 0)
+		d.stats.close()
+		close(d.over)
+	})
+	<-d.over
+}
+
+// 与Done并发的入队可能晚于run协程的最后一次处理, 等入队结束后放弃剩余任务
+func (d *Async) discard() {
+	for atomic.LoadInt32(&d.pushing) > 0 {
+		runtime.Gosched()
+	}
+	for t := d.pop(); t.f != nil; t = d.pop() {
+		atomic.AddInt32(&d.losts, 1)
+		t.discard(ErrStopped)
+	}
+}
+
+// 设置有界模式(需在Start之前调用), timeout仅对POLICY_TIMEOUT有效
+func (d *Async) SetBound(capacity int, policy int32, timeout time.Duration) {
+	if capacity > 0 {
+		d.bound = newBound(capacity, policy, timeout)
+	}
+}
+
+// 被拒绝的任务数
+func (d *Async) GetRejected() uint64 {
+	return d.bound.GetRejected()
+}
+
+// 被挤掉的旧任务数
+func (d *Async) GetDropped() uint64 {
+	return d.bound.GetDropped()
+}
+
+// 启用运行统计并注册到全局(需在Start之前调用), Wait后注销
+func (d *Async) EnableStats(name string) *Stats {
+	if d.stats == nil {
+		d.stats = newStats(name, d)
+	}
+	return d.stats
+}
+
+func (d *Async) GetStats() *Stats {
+	return d.stats
 }
 
 func (d *Async) Push(f func()) {
-	if atomic.CompareAndSwapInt32(&d.status, 1, 1) {
-		d.queue.Push(f)
-		select {
-		case d.notify <- struct{}{}:
-		default:
+	d.PushContext(context.Background(), f)
+}
+
+// 有界模式下按策略入队, ctx控制阻塞等待时长
+// 注意: 阻塞策略下不要在任务内部向自身Push, 否则可能死锁
+func (d *Async) PushContext(ctx context.Context, f func()) error {
+	return d.PushLaneContext(ctx, -1, f)
+}
+
+// 推送到指定优先级通道
+func (d *Async) PushLane(lane int, f func()) {
+	d.PushLaneContext(context.Background(), lane, f)
+}
+
+func (d *Async) PushLaneContext(ctx context.Context, lane int, f func()) error {
+	return d.pushTask(ctx, lane, task{f: f})
+}
+
+func (d *Async) pushTask(ctx context.Context, lane int, t task) error {
+	atomic.AddInt32(&d.pushing, 1)
+	defer atomic.AddInt32(&d.pushing, -1)
+	if !atomic.CompareAndSwapInt32(&d.status, 1, 1) {
+		return ErrStopped
+	}
+	if d.stats != nil {
+		t.f = d.stats.wrap(t.f)
+	}
+	if d.bound != nil {
+		if err := d.bound.push(ctx, d.exit, d.lanes, lane, t); err != nil {
+			return err
 		}
+	} else {
+		d.lanes.push(lane, t)
+	}
+	select {
+	case d.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (d *Async) pop() task {
+	if d.bound != nil {
+		return d.bound.pop(d.lanes)
 	}
+	return d.lanes.pop()
 }
 
 func (d *Async) run() {
 	defer func() {
-		for f := d.queue.Pop(); f != nil; f = d.queue.Pop() {
-			Recover(f)
+		for t := d.pop(); t.f != nil; t = d.pop() {
+			d.exec(t)
 		}
 		d.group.Done()
 	}()
 	for {
 		select {
 		case <-d.notify:
-			for f := d.queue.Pop(); f != nil; f = d.queue.Pop() {
-				Recover(f)
+			for t := d.pop(); t.f != nil; t = d.pop() {
+				d.exec(t)
 			}
 		case <-d.exit:
 			return
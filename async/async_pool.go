@@ -1,29 +1,56 @@
 package async
 
 import (
+	"context"
+	"runtime"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 type AsyncPool struct {
-	once   sync.Once
-	group  sync.WaitGroup
-	list   chan func()    // 任务抢占队列
-	queue  *Queue[func()] // 任务队列
-	notify chan struct{}  // 通知
-	exit   chan struct{}  // 退出
-	id     uint64         // 唯一id
-	status int32          // 状态
-	size   int            // 协程数量
+	once     sync.Once
+	exitOnce sync.Once // 关闭exit
+	overOnce sync.Once // 等待结束
+	group    sync.WaitGroup
+	list     chan task     // 任务抢占队列(无缓冲, 保证按优先级出队)
+	lanes    *lanes        // 任务队列
+	bound    *bound        // 有界模式, nil为无界
+	stats    *Stats        // 运行统计, nil为不统计
+	notify   chan struct{} // 通知
+	exit     chan struct{} // 退出
+	over     chan struct{} // 全部结束
+	id       uint64        // 唯一id
+	status   int32         // 状态
+	abort    int32         // 放弃剩余任务
+	losts    int32         // 放弃的任务数
+	abandon  sync.Once     // 到期时统计放弃的任务
+	abandons int32         // 到期时已放弃和仍在排队的任务数
+	pushing  int32         // 正在入队的调用数
+	holding  int32         // run协程已取出等待投递的任务数
+
+	handles sync.WaitGroup // 工作协程
+	minSize int32          // 最少协程数量
+	maxSize int32          // 最多协程数量
+	workers int32          // 当前协程数量
+	busy    int32          // 正在执行任务的协程数量
+	idle    int64          // 空闲多久后缩容(纳秒)
+	idleAt  time.Time      // 开始空闲的时间
 }
 
+const (
+	scaleInterval = 100 * time.Millisecond // 扩缩容检查间隔
+)
+
 func NewAsyncPool(size int) *AsyncPool {
 	return &AsyncPool{
-		size:   size,
-		queue:  NewQueue[func()](),
-		list:   make(chan func(), 50),
-		notify: make(chan struct{}, 1),
-		exit:   make(chan struct{}),
+		minSize: int32(size),
+		maxSize: int32(size),
+		lanes:   newLanes(0),
+		list:    make(chan task),
+		notify:  make(chan struct{}, 1),
+		exit:    make(chan struct{}),
+		over:    make(chan struct{}),
 	}
 }
 
@@ -39,14 +66,30 @@ func (d *AsyncPool) SetId(id uint64) {
 	atomic.StoreUint64(&d.id, id)
 }
 
+// 待处理任务数
+func (d *AsyncPool) GetCount() int32 {
+	return d.lanes.GetCount()
+}
+
+// 各优先级通道待处理任务数
+func (d *AsyncPool) GetLaneCounts() []int32 {
+	return d.lanes.GetCounts()
+}
+
+// 设置优先级通道(需在Start之前调用)
+// weights为各通道每轮最多连续执行的任务数, 编号越小优先级越高, normal为Push默认使用的通道
+func (d *AsyncPool) SetLanes(normal int, weights ...int) {
+	d.lanes = newLanes(normal, weights...)
+}
+
 func (d *AsyncPool) Start() {
 	if atomic.CompareAndSwapInt32(&d.status, 0, 1) {
 		d.once.Do(func() {
 			d.group.Add(1)
-			go d.run()
-			for i := 0; i < d.size; i++ {
-				go d.handle()
+			for i := int32(0); i < atomic.LoadInt32(&d.minSize); i++ {
+				d.spawn()
 			}
+			go d.run()
 		})
 	}
 }
@@ -55,49 +98,261 @@ func (d *AsyncPool) Stop() {
 	atomic.CompareAndSwapInt32(&d.status, 1, 0)
 }
 
+// 绑定父ctx启动, ctx取消后停止接收任务并处理完剩余任务
+func (d *AsyncPool) StartContext(ctx context.Context) {
+	d.Start()
+	context.AfterFunc(ctx, d.Done)
+}
+
+// 停止接收任务, 可重复调用
 func (d *AsyncPool) Done() {
-	atomic.StoreInt32(&d.status, 0)
-	close(d.exit)
+	d.exitOnce.Do(func() {
+		atomic.StoreInt32(&d.status, 0)
+		close(d.exit)
+	})
+}
+
+// 停止接收任务并处理剩余任务, ctx到期后立即返回, 未开始的任务在后台放弃(不会中断正在执行的任务)
+// 返回放弃的任务数(到期时仍在排队的任务), 可并发重复调用
+func (d *AsyncPool) Shutdown(ctx context.Context) (int, error) {
+	d.Done()
+	go d.Wait()
+	select {
+	case <-d.over:
+		return int(atomic.LoadInt32(&d.losts)), nil
+	case <-ctx.Done():
+		d.abandon.Do(func() {
+			atomic.StoreInt32(&d.abort, 1)
+			atomic.StoreInt32(&d.abandons, atomic.LoadInt32(&d.losts)+d.lanes.GetCount()+atomic.LoadInt32(&d.holding))
+		})
+		return int(atomic.LoadInt32(&d.abandons)), ctx.Err()
+	}
+}
+
+// 执行任务, 放弃模式下只计数并通知任务已被丢弃
+func (d *AsyncPool) exec(t task) {
+	if atomic.LoadInt32(&d.abort) > 0 {
+		atomic.AddInt32(&d.losts, 1)
+		t.discard(ErrStopped)
+		return
+	}
+	CatchId(d.GetId(), t.f)
 }
 
+// 等待所有任务结束, 需先调用Done
 func (d *AsyncPool) Wait() {
-	atomic.StoreUint64(&d.id, 0)
-	d.group.Wait()
-	d.group.Add(d.size)
-	close(d.list)
-	d.group.Wait()
+	d.overOnce.Do(func() {
+		d.group.Wait()
+		d.discard()
+		close(d.list)
+		d.handles.Wait()
+		// 剩余任务处理完后再清零, 处理期间的panic仍记录id
+		atomic.StoreUint64(&d.id, 0)
+		d.stats.close()
+		close(d.over)
+	})
+	<-d.over
+}
+
+// 与Done并发的入队可能晚于run协程的最后一次处理, 等入队结束后放弃剩余任务
+func (d *AsyncPool) discard() {
+	for atomic.LoadInt32(&d.pushing) > 0 {
+		runtime.Gosched()
+	}
+	for t := d.pop(); t.f != nil; t = d.pop() {
+		atomic.AddInt32(&d.losts, 1)
+		t.discard(ErrStopped)
+	}
+}
+
+// 设置自动扩缩容, 可在运行时调用
+// 任务投递持续阻塞(工作协程全忙)时扩容至max, 有协程空闲超过idle时逐个缩容至min
+func (d *AsyncPool) SetAutoScale(minSize, maxSize int, idle time.Duration) {
+	minSize = max(minSize, 1)
+	maxSize = max(maxSize, minSize)
+	atomic.StoreInt64(&d.idle, int64(idle))
+	atomic.StoreInt32(&d.minSize, int32(minSize))
+	atomic.StoreInt32(&d.maxSize, int32(maxSize))
+}
+
+// 当前协程数量
+func (d *AsyncPool) GetWorkers() int32 {
+	return atomic.LoadInt32(&d.workers)
+}
+
+// 设置有界模式(需在Start之前调用), timeout仅对POLICY_TIMEOUT有效
+func (d *AsyncPool) SetBound(capacity int, policy int32, timeout time.Duration) {
+	if capacity > 0 {
+		d.bound = newBound(capacity, policy, timeout)
+	}
+}
+
+// 被拒绝的任务数
+func (d *AsyncPool) GetRejected() uint64 {
+	return d.bound.GetRejected()
+}
+
+// 被挤掉的旧任务数
+func (d *AsyncPool) GetDropped() uint64 {
+	return d.bound.GetDropped()
+}
+
+// 启用运行统计并注册到全局(需在Start之前调用), Wait后注销
+func (d *AsyncPool) EnableStats(name string) *Stats {
+	if d.stats == nil {
+		d.stats = newStats(name, d)
+	}
+	return d.stats
+}
+
+func (d *AsyncPool) GetStats() *Stats {
+	return d.stats
 }
 
 func (d *AsyncPool) Push(f func()) {
-	if atomic.CompareAndSwapInt32(&d.status, 1, 1) {
-		d.queue.Push(f)
+	d.PushContext(context.Background(), f)
+}
+
+// 有界模式下按策略入队, ctx控制阻塞等待时长
+// 注意: 阻塞策略下不要在任务内部向自身Push, 否则可能死锁
+func (d *AsyncPool) PushContext(ctx context.Context, f func()) error {
+	return d.PushLaneContext(ctx, -1, f)
+}
+
+// 推送到指定优先级通道
+func (d *AsyncPool) PushLane(lane int, f func()) {
+	d.PushLaneContext(context.Background(), lane, f)
+}
+
+func (d *AsyncPool) PushLaneContext(ctx context.Context, lane int, f func()) error {
+	return d.pushTask(ctx, lane, task{f: f})
+}
+
+func (d *AsyncPool) pushTask(ctx context.Context, lane int, t task) error {
+	atomic.AddInt32(&d.pushing, 1)
+	defer atomic.AddInt32(&d.pushing, -1)
+	if !atomic.CompareAndSwapInt32(&d.status, 1, 1) {
+		return ErrStopped
+	}
+	if d.stats != nil {
+		t.f = d.stats.wrap(t.f)
+	}
+	if d.bound != nil {
+		if err := d.bound.push(ctx, d.exit, d.lanes, lane, t); err != nil {
+			return err
+		}
+	} else {
+		d.lanes.push(lane, t)
+	}
+	select {
+	case d.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// 有界模式下名额在工作协程接收任务后才归还
+func (d *AsyncPool) pop() task {
+	if d.bound != nil {
+		return d.bound.take(d.lanes)
+	}
+	return d.lanes.pop()
+}
+
+func (d *AsyncPool) spawn() {
+	atomic.AddInt32(&d.workers, 1)
+	d.handles.Add(1)
+	go d.handle()
+}
+
+// 收到空任务时退出(缩容)
+func (d *AsyncPool) handle() {
+	defer d.handles.Done()
+	for t := range d.list {
+		if t.f == nil {
+			return
+		}
+		atomic.AddInt32(&d.busy, 1)
+		d.exec(t)
+		atomic.AddInt32(&d.busy, -1)
+	}
+}
+
+// 按上下限调整协程数量, 仅在run协程中调用, saturated表示有任务等待投递
+func (d *AsyncPool) scale(saturated bool) {
+	minSize, maxSize := atomic.LoadInt32(&d.minSize), atomic.LoadInt32(&d.maxSize)
+	workers := atomic.LoadInt32(&d.workers)
+	switch {
+	case workers < minSize:
+		for ; workers < minSize; workers++ {
+			d.spawn()
+		}
+	case workers > maxSize:
+		d.shrink(workers - maxSize)
+	case saturated && workers < maxSize:
+		// 饱和, 按当前数量的一半扩容
+		for add := min(max(workers/2, 1), maxSize-workers); add > 0; add-- {
+			d.spawn()
+		}
+		d.idleAt = time.Time{}
+	case workers > minSize && !saturated && atomic.LoadInt32(&d.busy) < workers:
+		now := time.Now()
+		if d.idleAt.IsZero() {
+			d.idleAt = now
+		} else if now.Sub(d.idleAt) >= time.Duration(atomic.LoadInt64(&d.idle)) {
+			d.shrink(1)
+			d.idleAt = now
+		}
+	default:
+		d.idleAt = time.Time{}
+	}
+}
+
+func (d *AsyncPool) shrink(count int32) {
+	for ; count > 0; count-- {
 		select {
-		case d.notify <- struct{}{}:
+		case d.list <- task{}:
+			atomic.AddInt32(&d.workers, -1)
 		default:
+			return
 		}
 	}
 }
 
-func (d *AsyncPool) handle() {
-	for f := range d.list {
-		Recover(f)
+// 投递到工作协程, 阻塞期间仍进行扩缩容检查
+func (d *AsyncPool) dispatch(tick <-chan time.Time, t task) {
+	atomic.StoreInt32(&d.holding, 1)
+	defer atomic.StoreInt32(&d.holding, 0)
+	for {
+		select {
+		case d.list <- t:
+			if d.bound != nil {
+				d.bound.release()
+			}
+			return
+		case <-tick:
+			d.scale(true)
+		}
 	}
-	d.Done()
 }
 
 func (d *AsyncPool) run() {
+	tt := time.NewTicker(scaleInterval)
 	defer func() {
-		for f := d.queue.Pop(); f != nil; f = d.queue.Pop() {
-			d.list <- f
+		for t := d.pop(); t.f != nil; t = d.pop() {
+			d.dispatch(tt.C, t)
 		}
-		d.Done()
+		tt.Stop()
+		d.group.Done()
 	}()
 	for {
 		select {
 		case <-d.notify:
-			for f := d.queue.Pop(); f != nil; f = d.queue.Pop() {
-				d.list <- f
+			for t := d.pop(); t.f != nil; t = d.pop() {
+				d.dispatch(tt.C, t)
 			}
+		case <-tt.C:
+			d.scale(false)
 		case <-d.exit:
 			return
 		}
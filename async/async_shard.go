@@ -0,0 +1,191 @@
+package async
+
+import (
+	"context"
+	"encoding/binary"
+	"sort"
+	"sync"
+
+	"github.com/hechh/library/pool"
+)
+
+const (
+	shardReplicas = 64 // 每个分片的虚拟节点数
+)
+
+type shardNode struct {
+	hash  uint64
+	index int
+}
+
+// 按key一致性哈希分片的执行器, 相同key的任务串行有序, 不同key并行
+type AsyncShard struct {
+	mutex   sync.RWMutex
+	asyncs  []*Async
+	ring    []shardNode // 哈希环, 按hash升序
+	started bool
+}
+
+func NewAsyncShard(size int) *AsyncShard {
+	ret := &AsyncShard{}
+	for i := 0; i < size; i++ {
+		ret.asyncs = append(ret.asyncs, NewAsync())
+	}
+	ret.ring = buildRing(size)
+	return ret
+}
+
+func hashUint64(val uint64) uint64 {
+	buf := [8]byte{}
+	binary.LittleEndian.PutUint64(buf[:], val)
+	hh := pool.GetHash64()
+	defer pool.PutHash64(hh)
+	hh.Reset()
+	hh.Write(buf[:])
+	return hh.Sum64()
+}
+
+func buildRing(size int) []shardNode {
+	ring := make([]shardNode, 0, size*shardReplicas)
+	for i := 0; i < size; i++ {
+		for j := 0; j < shardReplicas; j++ {
+			ring = append(ring, shardNode{hash: hashUint64(uint64(i)<<32 | uint64(j)), index: i})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool {
+		return ring[i].hash < ring[j].hash
+	})
+	return ring
+}
+
+// 分片数量
+func (d *AsyncShard) Size() int {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return len(d.asyncs)
+}
+
+func (d *AsyncShard) Start() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.started = true
+	for _, aa := range d.asyncs {
+		aa.Start()
+	}
+}
+
+func (d *AsyncShard) Done() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.started = false
+	for _, aa := range d.asyncs {
+		aa.Done()
+	}
+}
+
+func (d *AsyncShard) Wait() {
+	d.mutex.RLock()
+	asyncs := d.asyncs
+	d.mutex.RUnlock()
+	for _, aa := range asyncs {
+		aa.Wait()
+	}
+}
+
+func (d *AsyncShard) index(key uint64) int {
+	hh := hashUint64(key)
+	pos := sort.Search(len(d.ring), func(i int) bool {
+		return d.ring[i].hash >= hh
+	})
+	if pos >= len(d.ring) {
+		pos = 0
+	}
+	return d.ring[pos].index
+}
+
+func (d *AsyncShard) Push(key uint64, f func()) {
+	d.PushContext(context.Background(), key, f)
+}
+
+func (d *AsyncShard) PushContext(ctx context.Context, key uint64, f func()) error {
+	return d.pushTask(ctx, key, -1, task{f: f})
+}
+
+func (d *AsyncShard) pushTask(ctx context.Context, key uint64, lane int, t task) error {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	if len(d.asyncs) <= 0 {
+		return ErrStopped
+	}
+	return d.asyncs[d.index(key)].pushTask(ctx, lane, t)
+}
+
+// 返回绑定key的执行器, 可配合Submit使用
+func (d *AsyncShard) Key(key uint64) IExecutor {
+	return &shardKey{shard: d, key: key}
+}
+
+// 调整分片数量
+// 调整前已入队的任务全部执行完毕后, 新任务才会开始执行, 保证迁移的key仍然有序
+func (d *AsyncShard) Resize(size int) {
+	if size <= 0 {
+		return
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if size == len(d.asyncs) {
+		return
+	}
+
+	// 旧分片上的屏障
+	barriers := make([]chan struct{}, 0, len(d.asyncs))
+	for _, aa := range d.asyncs {
+		ch := make(chan struct{})
+		barriers = append(barriers, ch)
+		if err := aa.PushContext(context.Background(), func() { close(ch) }); err != nil {
+			close(ch)
+		}
+	}
+
+	olds := d.asyncs
+	if size < len(olds) {
+		d.asyncs = olds[:size:size]
+		for _, aa := range olds[size:] {
+			aa.Done()
+			go aa.Wait()
+		}
+	} else {
+		d.asyncs = append(olds[:len(olds):len(olds)], make([]*Async, size-len(olds))...)
+		for i := len(olds); i < size; i++ {
+			d.asyncs[i] = NewAsync()
+			if d.started {
+				d.asyncs[i].Start()
+			}
+		}
+	}
+	d.ring = buildRing(size)
+
+	// 新任务需等待所有旧任务执行完
+	// 每个分片都插入屏障, 未迁移key的分片也会短暂等待, 以此换取实现简单, Resize应低频调用
+	wait := func() {
+		for _, ch := range barriers {
+			<-ch
+		}
+	}
+	for _, aa := range d.asyncs {
+		aa.PushContext(context.Background(), wait)
+	}
+}
+
+type shardKey struct {
+	shard *AsyncShard
+	key   uint64
+}
+
+func (d *shardKey) PushContext(ctx context.Context, f func()) error {
+	return d.shard.PushContext(ctx, d.key, f)
+}
+
+func (d *shardKey) pushTask(ctx context.Context, lane int, t task) error {
+	return d.shard.pushTask(ctx, d.key, lane, t)
+}
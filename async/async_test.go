@@ -1,6 +1,16 @@
 package async
 
-import "testing"
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
 
 func TestPool(t *testing.T) {
 	aa := NewAsyncPool(50)
@@ -23,3 +33,526 @@ func TestAsync(t *testing.T) {
 	aa.Done()
 	aa.Wait()
 }
+
+func TestBound(t *testing.T) {
+	aa := NewAsync()
+	aa.SetBound(2, POLICY_REJECT, 0)
+	aa.Start()
+	block := make(chan struct{})
+	aa.Push(func() { <-block })
+	for aa.GetCount() > 0 {
+		runtime.Gosched()
+	}
+	if err := aa.PushContext(context.Background(), func() {}); err != nil {
+		t.Fatal(err)
+	}
+	if err := aa.PushContext(context.Background(), func() {}); err != nil {
+		t.Fatal(err)
+	}
+	if err := aa.PushContext(context.Background(), func() {}); err != ErrFull {
+		t.Fatalf("expect ErrFull, got %v", err)
+	}
+	if aa.GetRejected() != 1 {
+		t.Fatalf("rejected: %d", aa.GetRejected())
+	}
+	close(block)
+	aa.Done()
+	aa.Wait()
+}
+
+func TestBoundDropOldest(t *testing.T) {
+	aa := NewAsync()
+	aa.SetBound(2, POLICY_DROP_OLDEST, 0)
+	aa.Start()
+	block := make(chan struct{})
+	aa.Push(func() { <-block })
+	for aa.GetCount() > 0 {
+		runtime.Gosched()
+	}
+	var rets []int
+	for i := 0; i < 5; i++ {
+		aa.Push(func() { rets = append(rets, i) })
+	}
+	if aa.GetDropped() != 3 {
+		t.Fatalf("dropped: %d", aa.GetDropped())
+	}
+	close(block)
+	aa.Done()
+	aa.Wait()
+	if len(rets) != 2 || rets[0] != 3 || rets[1] != 4 {
+		t.Fatalf("rets: %v", rets)
+	}
+}
+
+func TestBoundTimeout(t *testing.T) {
+	aa := NewAsync()
+	aa.SetBound(1, POLICY_TIMEOUT, 10*time.Millisecond)
+	aa.Start()
+	block := make(chan struct{})
+	aa.Push(func() { <-block })
+	for aa.GetCount() > 0 {
+		runtime.Gosched()
+	}
+	aa.Push(func() {})
+	if err := aa.PushContext(context.Background(), func() {}); err != context.DeadlineExceeded {
+		t.Fatalf("expect timeout, got %v", err)
+	}
+	close(block)
+	aa.Done()
+	aa.Wait()
+}
+
+func TestBoundPool(t *testing.T) {
+	aa := NewAsyncPool(4)
+	aa.SetBound(8, POLICY_BLOCK, 0)
+	aa.Start()
+	count := int32(0)
+	for i := 0; i < 1000; i++ {
+		aa.Push(func() { atomic.AddInt32(&count, 1) })
+	}
+	aa.Done()
+	aa.Wait()
+	if count != 1000 {
+		t.Fatalf("count: %d", count)
+	}
+}
+
+func TestBoundPoolReject(t *testing.T) {
+	aa := NewAsyncPool(1)
+	aa.SetBound(2, POLICY_REJECT, 0)
+	aa.Start()
+	block := make(chan struct{})
+	aa.Push(func() { <-block })
+	for atomic.LoadInt32(&aa.busy) <= 0 {
+		runtime.Gosched()
+	}
+	accepted := 0
+	for i := 0; i < 100; i++ {
+		if aa.PushContext(context.Background(), func() {}) == nil {
+			accepted++
+		}
+	}
+	if accepted != 2 || aa.GetRejected() != 98 {
+		t.Fatalf("accepted: %d, rejected: %d", accepted, aa.GetRejected())
+	}
+	close(block)
+	aa.Done()
+	aa.Wait()
+}
+
+func TestFuture(t *testing.T) {
+	aa := NewAsync()
+	aa.Start()
+	defer func() {
+		aa.Done()
+		aa.Wait()
+	}()
+
+	ff := Submit(aa, func(ctx context.Context) (int, error) { return 1, nil })
+	rr := Map(ff, nil, func(v int) (string, error) { return fmt.Sprint(v + 1), nil })
+	if val, err := rr.Get(context.Background()); err != nil || val != "2" {
+		t.Fatalf("val: %v, err: %v", val, err)
+	}
+
+	pp := Submit(aa, func(ctx context.Context) (int, error) { panic("boom") })
+	if _, err := pp.Get(context.Background()); err == nil {
+		t.Fatal("expect panic error")
+	} else if _, ok := err.(*PanicError); !ok {
+		t.Fatalf("expect *PanicError, got %T", err)
+	}
+
+	tt := SubmitTimeout(aa, 10*time.Millisecond, func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		return 0, nil
+	})
+	if _, err := tt.Get(context.Background()); err != context.DeadlineExceeded {
+		t.Fatalf("expect timeout, got %v", err)
+	}
+}
+
+func TestFutureThen(t *testing.T) {
+	aa, bb := NewAsync(), NewAsync()
+	aa.Start()
+	bb.Start()
+	result := make(chan int, 1)
+	// aa向bb发起请求, 结果回到aa上处理, 不阻塞aa
+	aa.Push(func() {
+		Submit(bb, func(ctx context.Context) (int, error) { return 7, nil }).Then(aa, func(v int, err error) {
+			result <- v
+		})
+	})
+	if v := <-result; v != 7 {
+		t.Fatalf("v: %d", v)
+	}
+	aa.Done()
+	bb.Done()
+	aa.Wait()
+	bb.Wait()
+}
+
+func TestFutureDiscard(t *testing.T) {
+	// 被挤掉的任务以ErrFull完成
+	aa := NewAsync()
+	aa.SetBound(1, POLICY_DROP_OLDEST, 0)
+	aa.Start()
+	block := make(chan struct{})
+	aa.Push(func() { <-block })
+	for aa.GetCount() > 0 {
+		runtime.Gosched()
+	}
+	ff := Submit(aa, func(ctx context.Context) (int, error) { return 1, nil })
+	aa.Push(func() {})
+	if _, err := ff.Get(context.Background()); err != ErrFull {
+		t.Fatalf("expect ErrFull, got %v", err)
+	}
+	close(block)
+	aa.Done()
+	aa.Wait()
+
+	// 关闭超时被放弃的任务以ErrStopped完成
+	bb := NewAsyncPool(1)
+	bb.Start()
+	block = make(chan struct{})
+	bb.Push(func() { <-block })
+	gg := Submit(bb, func(ctx context.Context) (int, error) { return 1, nil })
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	go func() {
+		for atomic.LoadInt32(&bb.abort) <= 0 {
+			runtime.Gosched()
+		}
+		close(block)
+	}()
+	if losts, err := bb.Shutdown(ctx); losts != 1 || err == nil {
+		t.Fatalf("losts: %d, err: %v", losts, err)
+	}
+	if _, err := gg.Get(context.Background()); err != ErrStopped {
+		t.Fatalf("expect ErrStopped, got %v", err)
+	}
+
+	// 回调无法投递时以推送错误回调
+	result := make(chan error, 1)
+	NewFuture[int]().Then(bb, func(v int, err error) { result <- err }).Resolve(1, nil)
+	if err := <-result; err != ErrStopped {
+		t.Fatalf("expect ErrStopped, got %v", err)
+	}
+}
+
+func TestFutureStopRace(t *testing.T) {
+	for i := 0; i < 200; i++ {
+		aa := NewAsync()
+		aa.Start()
+		ffs := make(chan *Future[int], 10)
+		go func() {
+			defer close(ffs)
+			for j := 0; j < 10; j++ {
+				ffs <- Submit(aa, func(ctx context.Context) (int, error) { return j, nil })
+			}
+		}()
+		aa.Done()
+		aa.Wait()
+		// 与Done并发提交的任务要么执行要么失败, 不会一直挂起
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		for ff := range ffs {
+			if _, err := ff.Get(ctx); err == context.DeadlineExceeded {
+				t.Fatal("future never resolved")
+			}
+		}
+		cancel()
+	}
+}
+
+func TestShard(t *testing.T) {
+	aa := NewAsyncShard(4)
+	aa.Start()
+	rets := map[uint64][]int{}
+	mutex := sync.Mutex{}
+	for i := 0; i < 300; i++ {
+		if i == 100 {
+			aa.Resize(8)
+		}
+		if i == 200 {
+			aa.Resize(2)
+		}
+		key := uint64(i % 10)
+		aa.Push(key, func() {
+			mutex.Lock()
+			rets[key] = append(rets[key], i)
+			mutex.Unlock()
+		})
+	}
+	aa.Done()
+	aa.Wait()
+	for key, list := range rets {
+		if len(list) != 30 || !sort.IntsAreSorted(list) {
+			t.Fatalf("key: %d, list: %v", key, list)
+		}
+	}
+
+	// 扩容时只有迁往新分片的key改变分片
+	bb := NewAsyncShard(4)
+	olds := make([]int, 1000)
+	for key := range olds {
+		olds[key] = bb.index(uint64(key))
+	}
+	bb.Resize(5)
+	stays := 0
+	for key, old := range olds {
+		switch index := bb.index(uint64(key)); index {
+		case old:
+			stays++
+		case 4:
+		default:
+			t.Fatalf("key: %d, moved from %d to %d", key, old, index)
+		}
+	}
+	if stays < 700 {
+		t.Fatalf("stays: %d", stays)
+	}
+}
+
+func TestLanes(t *testing.T) {
+	aa := NewAsync()
+	aa.SetLanes(PRIORITY_NORMAL, 4, 2, 1)
+	aa.Start()
+	block := make(chan struct{})
+	aa.PushLane(PRIORITY_LOW, func() { <-block })
+	for aa.GetCount() > 0 {
+		runtime.Gosched()
+	}
+	rets := []int{}
+	for i := 0; i < 4; i++ {
+		aa.PushLane(PRIORITY_LOW, func() { rets = append(rets, PRIORITY_LOW) })
+		aa.Push(func() { rets = append(rets, PRIORITY_NORMAL) })
+	}
+	for i := 0; i < 8; i++ {
+		aa.PushLane(PRIORITY_HIGH, func() { rets = append(rets, PRIORITY_HIGH) })
+	}
+	if counts := aa.GetLaneCounts(); counts[0] != 8 || counts[1] != 4 || counts[2] != 4 {
+		t.Fatalf("counts: %v", counts)
+	}
+	close(block)
+	aa.Done()
+	aa.Wait()
+	expect := []int{0, 0, 0, 0, 1, 1, 2, 0, 0, 0, 0, 1, 1, 2, 2, 2}
+	if fmt.Sprint(rets) != fmt.Sprint(expect) {
+		t.Fatalf("rets: %v", rets)
+	}
+}
+
+func TestLanesNormal(t *testing.T) {
+	for _, normal := range []int{-1, 5} {
+		aa := NewAsync()
+		aa.SetLanes(normal, 1, 1)
+		aa.Start()
+		aa.Push(func() {})
+		aa.Done()
+		aa.Wait()
+	}
+}
+
+func TestLanesPool(t *testing.T) {
+	aa := NewAsyncPool(1)
+	aa.SetLanes(PRIORITY_NORMAL, 4, 2, 1)
+	aa.Start()
+	block := make(chan struct{})
+	aa.PushLane(PRIORITY_LOW, func() { <-block })
+	for atomic.LoadInt32(&aa.busy) <= 0 {
+		runtime.Gosched()
+	}
+	// 占位任务被run协程取出并等待投递, 之后的任务都留在优先级通道中
+	aa.PushLane(PRIORITY_LOW, func() {})
+	for aa.GetCount() > 0 {
+		runtime.Gosched()
+	}
+	rets := []int{}
+	for i := 0; i < 4; i++ {
+		aa.PushLane(PRIORITY_LOW, func() { rets = append(rets, PRIORITY_LOW) })
+		aa.Push(func() { rets = append(rets, PRIORITY_NORMAL) })
+	}
+	for i := 0; i < 8; i++ {
+		aa.PushLane(PRIORITY_HIGH, func() { rets = append(rets, PRIORITY_HIGH) })
+	}
+	if counts := aa.GetLaneCounts(); counts[0] != 8 || counts[1] != 4 || counts[2] != 4 {
+		t.Fatalf("counts: %v", counts)
+	}
+	close(block)
+	aa.Done()
+	aa.Wait()
+	expect := []int{0, 0, 0, 0, 1, 1, 2, 0, 0, 0, 0, 1, 1, 2, 2, 2}
+	if fmt.Sprint(rets) != fmt.Sprint(expect) {
+		t.Fatalf("rets: %v", rets)
+	}
+}
+
+func TestStats(t *testing.T) {
+	aa := NewAsync()
+	st := aa.EnableStats("player")
+	slows := []*SlowTask{}
+	st.SetSlow(5*time.Millisecond, func(task *SlowTask) { slows = append(slows, task) })
+	aa.Start()
+	aa.Push(func() {})
+	aa.Push(func() { time.Sleep(10 * time.Millisecond) })
+	aa.Push(func() { panic("boom") })
+
+	found := false
+	RangeStats(func(s *Stats) bool {
+		found = found || s == st
+		return true
+	})
+	if !found {
+		t.Fatal("stats not registered")
+	}
+	aa.Done()
+	aa.Wait()
+
+	snap := st.Snapshot()
+	if snap.Completed != 3 || snap.Panicked != 1 || snap.Runs.Count != 3 || snap.Waits.Count != 3 {
+		t.Fatalf("snapshot: %+v", snap)
+	}
+	if len(slows) != 1 || !strings.HasPrefix(slows[0].Caller, "async_test.go:") {
+		t.Fatalf("slows: %+v", slows)
+	}
+	for _, item := range GetAllStats() {
+		if item.Name == "player" {
+			t.Fatal("stats not unregistered")
+		}
+	}
+}
+
+func TestAutoScale(t *testing.T) {
+	aa := NewAsyncPool(1)
+	aa.SetAutoScale(1, 8, 50*time.Millisecond)
+	aa.Start()
+	block := make(chan struct{})
+	for i := 0; i < 100; i++ {
+		aa.Push(func() { <-block })
+	}
+	for i := 0; i < 100 && aa.GetWorkers() < 8; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if aa.GetWorkers() != 8 {
+		t.Fatalf("expect scale up, workers: %d", aa.GetWorkers())
+	}
+	close(block)
+	for i := 0; i < 100 && aa.GetWorkers() > 1; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if aa.GetWorkers() != 1 {
+		t.Fatalf("expect scale down, workers: %d", aa.GetWorkers())
+	}
+	aa.SetAutoScale(3, 3, 0)
+	for i := 0; i < 100 && aa.GetWorkers() < 3; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if aa.GetWorkers() != 3 {
+		t.Fatalf("expect min bound, workers: %d", aa.GetWorkers())
+	}
+	aa.Done()
+	aa.Wait()
+}
+
+func TestShutdown(t *testing.T) {
+	aa := NewAsync()
+	aa.Start()
+	count := int32(0)
+	for i := 0; i < 10; i++ {
+		aa.Push(func() {
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&count, 1)
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 12*time.Millisecond)
+	defer cancel()
+	rets := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			lost, err := aa.Shutdown(ctx)
+			if err != context.DeadlineExceeded {
+				t.Errorf("expect deadline, got %v", err)
+			}
+			rets <- lost
+		}()
+	}
+	lost1, lost2 := <-rets, <-rets
+	aa.Wait()
+	if lost1 != lost2 || int(atomic.LoadInt32(&count))+lost1 != 10 || lost1 <= 0 {
+		t.Fatalf("count: %d, lost: %d %d", count, lost1, lost2)
+	}
+	if err := aa.PushContext(context.Background(), func() {}); err != ErrStopped {
+		t.Fatalf("expect ErrStopped, got %v", err)
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	aa := NewAsyncPool(1)
+	aa.Start()
+	aa.Push(func() { time.Sleep(200 * time.Millisecond) })
+	for i := 0; i < 5; i++ {
+		aa.Push(func() {})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	lost, err := aa.Shutdown(ctx)
+	if cost := time.Since(start); err != context.DeadlineExceeded || cost > 100*time.Millisecond {
+		t.Fatalf("err: %v, cost: %v", err, cost)
+	}
+	if lost != 5 {
+		t.Fatalf("lost: %d", lost)
+	}
+	aa.Wait()
+	if losts := atomic.LoadInt32(&aa.losts); losts != 5 {
+		t.Fatalf("losts: %d", losts)
+	}
+}
+
+func TestStartContext(t *testing.T) {
+	aa := NewAsyncPool(2)
+	ctx, cancel := context.WithCancel(context.Background())
+	aa.StartContext(ctx)
+	count := int32(0)
+	for i := 0; i < 10; i++ {
+		aa.Push(func() { atomic.AddInt32(&count, 1) })
+	}
+	cancel()
+	if lost, err := aa.Shutdown(context.Background()); lost != 0 || err != nil {
+		t.Fatalf("lost: %d, err: %v", lost, err)
+	}
+	if count != 10 {
+		t.Fatalf("count: %d", count)
+	}
+}
+
+func TestPanicHandler(t *testing.T) {
+	recs := []*PanicRecord{}
+	cancel := Subscribe(PanicFunc(func(rec *PanicRecord) { recs = append(recs, rec) }))
+	defer cancel()
+	SetPanicLimit(time.Minute)
+	defer SetPanicLimit(0)
+
+	aa := NewAsync()
+	aa.SetId(11)
+	aa.Start()
+	for i := 0; i < 3; i++ {
+		aa.Push(Label("save", func() { panic("boom") }))
+	}
+	aa.Done()
+	aa.Wait()
+
+	if len(recs) != 1 {
+		t.Fatalf("expect rate limited, recs: %d", len(recs))
+	}
+	if rec := recs[0]; rec.Id != 11 || rec.Label != "save" || rec.Value != "boom" || !strings.HasSuffix(rec.Caller(), "async_test.go:"+fmt.Sprint(rec.Frames[0].Line)) {
+		t.Fatalf("rec: %+v", rec)
+	}
+
+	SetRepanic(true)
+	defer SetRepanic(false)
+	defer func() {
+		if r := recover(); r != "crash" {
+			t.Fatalf("expect repanic, got %v", r)
+		}
+	}()
+	Recover(func() { panic("crash") })
+}
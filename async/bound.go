@@ -0,0 +1,124 @@
+package async
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hechh/library/uerror"
+)
+
+// 队列满时的处理策略
+const (
+	POLICY_BLOCK       = 0 // 阻塞调用方直到有空位
+	POLICY_TIMEOUT     = 1 // 阻塞调用方, 超时后拒绝
+	POLICY_DROP_NEWEST = 2 // 丢弃新任务
+	POLICY_DROP_OLDEST = 3 // 丢弃最旧的任务
+	POLICY_REJECT      = 4 // 返回错误
+)
+
+var (
+	ErrFull    = uerror.Err(-1, "任务队列已满")
+	ErrStopped = uerror.Err(-1, "任务队列已停止")
+)
+
+// 有界队列的名额控制
+type bound struct {
+	mutex    sync.Mutex    // DROP_OLDEST模式下保护Pop
+	slots    chan struct{} // 名额
+	policy   int32         // 满队列策略
+	timeout  time.Duration // POLICY_TIMEOUT的等待时长
+	rejected uint64        // 被拒绝的任务数
+	dropped  uint64        // 被挤掉的旧任务数
+}
+
+func newBound(capacity int, policy int32, timeout time.Duration) *bound {
+	return &bound{
+		slots:   make(chan struct{}, capacity),
+		policy:  policy,
+		timeout: timeout,
+	}
+}
+
+func (b *bound) GetRejected() uint64 {
+	if b == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&b.rejected)
+}
+
+func (b *bound) GetDropped() uint64 {
+	if b == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&b.dropped)
+}
+
+// 按策略申请名额并入队
+func (b *bound) push(ctx context.Context, exit <-chan struct{}, l *lanes, lane int, t task) error {
+	select {
+	case b.slots <- struct{}{}:
+		l.push(lane, t)
+		return nil
+	default:
+	}
+
+	switch b.policy {
+	case POLICY_BLOCK, POLICY_TIMEOUT:
+		if b.policy == POLICY_TIMEOUT && b.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, b.timeout)
+			defer cancel()
+		}
+		select {
+		case b.slots <- struct{}{}:
+			l.push(lane, t)
+			return nil
+		case <-ctx.Done():
+			atomic.AddUint64(&b.rejected, 1)
+			return ctx.Err()
+		case <-exit:
+			atomic.AddUint64(&b.rejected, 1)
+			return ErrStopped
+		}
+	case POLICY_DROP_OLDEST:
+		b.mutex.Lock()
+		old := l.popOldest()
+		b.mutex.Unlock()
+		if old.f != nil {
+			// 新任务继承被丢弃任务的名额
+			atomic.AddUint64(&b.dropped, 1)
+			l.push(lane, t)
+			old.discard(ErrFull)
+			return nil
+		}
+	}
+	atomic.AddUint64(&b.rejected, 1)
+	return ErrFull
+}
+
+// 出队并归还名额
+func (b *bound) pop(l *lanes) (t task) {
+	if t = b.take(l); t.f != nil {
+		b.release()
+	}
+	return
+}
+
+// 出队但不归还名额, 任务交给执行方后再调用release
+func (b *bound) take(l *lanes) (t task) {
+	if b.policy == POLICY_DROP_OLDEST {
+		b.mutex.Lock()
+		t = l.pop()
+		b.mutex.Unlock()
+	} else {
+		t = l.pop()
+	}
+	return
+}
+
+// 归还名额
+func (b *bound) release() {
+	<-b.slots
+}
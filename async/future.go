@@ -0,0 +1,206 @@
+package async
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// 可执行任务的执行器, Async和AsyncPool均已实现
+type IExecutor interface {
+	PushContext(context.Context, func()) error
+}
+
+// 支持丢弃通知的执行器, 任务被挤掉或放弃时调用fail
+type iTaskExecutor interface {
+	pushTask(context.Context, int, task) error
+}
+
+// 推送任务, 执行器支持时任务被丢弃后调用fail
+func pushTask(ctx context.Context, e IExecutor, f func(), fail func(error)) error {
+	if te, ok := e.(iTaskExecutor); ok {
+		return te.pushTask(ctx, -1, task{f: f, fail: fail})
+	}
+	return e.PushContext(ctx, f)
+}
+
+type Future[T any] struct {
+	mutex  sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	calls  []func()
+	value  T
+	err    error
+}
+
+func NewFuture[T any]() *Future[T] {
+	return newFuture[T](context.Background())
+}
+
+func newFuture[T any](ctx context.Context) *Future[T] {
+	ret := &Future[T]{done: make(chan struct{})}
+	ret.ctx, ret.cancel = context.WithCancel(ctx)
+	// 取消或超时后立即完成
+	context.AfterFunc(ret.ctx, func() {
+		var zero T
+		ret.Resolve(zero, ret.ctx.Err())
+	})
+	return ret
+}
+
+// 提交有返回值的任务到执行器
+func Submit[T any](e IExecutor, f func(context.Context) (T, error)) *Future[T] {
+	return SubmitContext(context.Background(), e, f)
+}
+
+// 提交任务, 超时后Future以context.DeadlineExceeded完成
+func SubmitTimeout[T any](e IExecutor, timeout time.Duration, f func(context.Context) (T, error)) *Future[T] {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ret := SubmitContext(ctx, e, f)
+	ret.onDone(cancel)
+	return ret
+}
+
+// 提交任务, ctx取消后Future以ctx.Err()完成, 尚未执行的任务将被跳过
+// 任务被挤掉时以ErrFull完成, 关闭时被放弃以ErrStopped完成
+func SubmitContext[T any](ctx context.Context, e IExecutor, f func(context.Context) (T, error)) *Future[T] {
+	ret := newFuture[T](ctx)
+	fail := func(err error) {
+		var zero T
+		ret.Resolve(zero, err)
+	}
+	err := pushTask(ctx, e, func() {
+		if ret.ctx.Err() != nil {
+			return
+		}
+		var val T
+		var ferr error
+		if perr := Catch(func() { val, ferr = f(ret.ctx) }); perr != nil {
+			ferr = perr
+		}
+		if cerr := ret.ctx.Err(); cerr != nil {
+			var zero T
+			val, ferr = zero, cerr
+		}
+		ret.Resolve(val, ferr)
+	}, fail)
+	if err != nil {
+		fail(err)
+	}
+	return ret
+}
+
+// 设置结果, 只有第一次有效
+func (d *Future[T]) Resolve(val T, err error) bool {
+	d.mutex.Lock()
+	select {
+	case <-d.done:
+		d.mutex.Unlock()
+		return false
+	default:
+	}
+	d.value, d.err = val, err
+	calls := d.calls
+	d.calls = nil
+	close(d.done)
+	d.mutex.Unlock()
+
+	d.cancel()
+	for _, f := range calls {
+		f()
+	}
+	return true
+}
+
+// 取消任务
+func (d *Future[T]) Cancel() {
+	d.cancel()
+}
+
+func (d *Future[T]) Done() <-chan struct{} {
+	return d.done
+}
+
+// 是否完成
+func (d *Future[T]) IsDone() bool {
+	select {
+	case <-d.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// 阻塞等待结果
+// 注意: 不要在执行该任务的执行器内部Get, 否则会死锁, 应使用Then
+func (d *Future[T]) Get(ctx context.Context) (T, error) {
+	select {
+	case <-d.done:
+		return d.value, d.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// 完成后回调, e不为空时回调在e上执行, 否则在完成Future的协程上执行
+// 回调无法投递到e(推送失败或被丢弃)时, 在当前协程以对应错误回调
+func (d *Future[T]) Then(e IExecutor, f func(T, error)) *Future[T] {
+	d.onDone(func() {
+		if e == nil {
+			Recover(func() { f(d.value, d.err) })
+			return
+		}
+		fail := func(err error) {
+			var zero T
+			Recover(func() { f(zero, err) })
+		}
+		if err := pushTask(context.Background(), e, func() { f(d.value, d.err) }, fail); err != nil {
+			fail(err)
+		}
+	})
+	return d
+}
+
+func (d *Future[T]) onDone(f func()) {
+	d.mutex.Lock()
+	select {
+	case <-d.done:
+		d.mutex.Unlock()
+		f()
+	default:
+		d.calls = append(d.calls, f)
+		d.mutex.Unlock()
+	}
+}
+
+// 转换结果, 前一个Future失败时直接传递错误
+func Map[T, R any](d *Future[T], e IExecutor, f func(T) (R, error)) *Future[R] {
+	ret := NewFuture[R]()
+	d.onDone(func() {
+		if d.err != nil {
+			var zero R
+			ret.Resolve(zero, d.err)
+			return
+		}
+		run := func() {
+			var val R
+			var err error
+			if perr := Catch(func() { val, err = f(d.value) }); perr != nil {
+				err = perr
+			}
+			ret.Resolve(val, err)
+		}
+		fail := func(err error) {
+			var zero R
+			ret.Resolve(zero, err)
+		}
+		if e == nil {
+			run()
+		} else if err := pushTask(context.Background(), e, run, fail); err != nil {
+			fail(err)
+		}
+	})
+	return ret
+}
@@ -0,0 +1,82 @@
+package async
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// 直方图桶上界: 100us, 200us, 400us ... 约26s, 最后一个桶收集超出部分
+var histogramBounds = func() (rets []time.Duration) {
+	for bound := 100 * time.Microsecond; bound <= 30*time.Second; bound *= 2 {
+		rets = append(rets, bound)
+	}
+	return
+}()
+
+// 无锁耗时直方图
+type Histogram struct {
+	counts [32]uint64
+	count  uint64
+	sum    int64
+	max    int64
+}
+
+type HistogramSnapshot struct {
+	Bounds []time.Duration `json:"bounds"` // 桶上界, Counts比Bounds多一个溢出桶
+	Counts []uint64        `json:"counts"`
+	Count  uint64          `json:"count"`
+	Sum    time.Duration   `json:"sum"`
+	Max    time.Duration   `json:"max"`
+}
+
+func (d *Histogram) Observe(val time.Duration) {
+	pos := 0
+	for pos < len(histogramBounds) && val > histogramBounds[pos] {
+		pos++
+	}
+	atomic.AddUint64(&d.counts[pos], 1)
+	atomic.AddUint64(&d.count, 1)
+	atomic.AddInt64(&d.sum, int64(val))
+	for old := atomic.LoadInt64(&d.max); int64(val) > old; old = atomic.LoadInt64(&d.max) {
+		if atomic.CompareAndSwapInt64(&d.max, old, int64(val)) {
+			break
+		}
+	}
+}
+
+func (d *Histogram) Snapshot() HistogramSnapshot {
+	ret := HistogramSnapshot{
+		Bounds: histogramBounds,
+		Counts: make([]uint64, len(histogramBounds)+1),
+		Count:  atomic.LoadUint64(&d.count),
+		Sum:    time.Duration(atomic.LoadInt64(&d.sum)),
+		Max:    time.Duration(atomic.LoadInt64(&d.max)),
+	}
+	for i := range ret.Counts {
+		ret.Counts[i] = atomic.LoadUint64(&d.counts[i])
+	}
+	return ret
+}
+
+// 平均耗时
+func (d HistogramSnapshot) Mean() time.Duration {
+	if d.Count <= 0 {
+		return 0
+	}
+	return d.Sum / time.Duration(d.Count)
+}
+
+// 估算分位数(返回所在桶的上界), q取值(0,1]
+func (d HistogramSnapshot) Quantile(q float64) time.Duration {
+	if d.Count <= 0 {
+		return 0
+	}
+	target := uint64(q * float64(d.Count))
+	total := uint64(0)
+	for i, cnt := range d.Counts {
+		if total += cnt; total >= target && i < len(d.Bounds) {
+			return d.Bounds[i]
+		}
+	}
+	return d.Max
+}
@@ -0,0 +1,98 @@
+package async
+
+// 任务优先级通道
+const (
+	PRIORITY_HIGH   = 0
+	PRIORITY_NORMAL = 1
+	PRIORITY_LOW    = 2
+)
+
+// 队列中的任务, fail在任务被丢弃(挤掉或放弃)时调用
+type task struct {
+	f    func()
+	fail func(error)
+}
+
+// 通知任务已被丢弃
+func (t task) discard(err error) {
+	if t.fail != nil {
+		t.fail(err)
+	}
+}
+
+// 多优先级任务通道, 按权重轮询出队, 低优先级通道也能获得执行机会
+// 编号越小优先级越高, 出队只允许单个消费者
+type lanes struct {
+	queues  []*Queue[task]
+	weights []int // 每轮最多连续出队数量
+	normal  int   // Push默认使用的通道
+	lane    int   // 当前轮询的通道
+	used    int   // 当前通道本轮已出队数量
+}
+
+func newLanes(normal int, weights ...int) *lanes {
+	if len(weights) <= 0 {
+		weights = []int{1}
+	}
+	ret := &lanes{normal: min(max(normal, 0), len(weights)-1), weights: make([]int, len(weights))}
+	for i, w := range weights {
+		ret.weights[i] = max(w, 1)
+		ret.queues = append(ret.queues, NewQueue[task]())
+	}
+	return ret
+}
+
+func (l *lanes) get(lane int) int {
+	if lane < 0 {
+		return l.normal
+	}
+	return min(lane, len(l.queues)-1)
+}
+
+// 待处理任务总数
+func (l *lanes) GetCount() (ret int32) {
+	for _, q := range l.queues {
+		ret += q.GetCount()
+	}
+	return
+}
+
+// 各通道待处理任务数
+func (l *lanes) GetCounts() []int32 {
+	rets := make([]int32, len(l.queues))
+	for i, q := range l.queues {
+		rets[i] = q.GetCount()
+	}
+	return rets
+}
+
+func (l *lanes) push(lane int, t task) {
+	l.queues[l.get(lane)].Push(t)
+}
+
+// 加权轮询出队
+func (l *lanes) pop() task {
+	for i := 0; i <= len(l.queues); i++ {
+		if l.used < l.weights[l.lane] {
+			if t := l.queues[l.lane].Pop(); t.f != nil {
+				l.used++
+				return t
+			}
+		}
+		l.lane = (l.lane + 1) % len(l.queues)
+		l.used = 0
+	}
+	// 全部为空, 下一轮从最高优先级开始
+	l.lane, l.used = 0, 0
+	return task{}
+}
+
+// 从优先级最低的非空通道丢弃最旧的任务
+func (l *lanes) popOldest() task {
+	for i := len(l.queues) - 1; i >= 0; i-- {
+		if t := l.queues[i].Pop(); t.f != nil {
+			return t
+		}
+	}
+	return task{}
+}
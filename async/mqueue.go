@@ -0,0 +1,127 @@
+package async
+
+import (
+	"sync/atomic"
+)
+
+type mnode[T any] struct {
+	next  atomic.Pointer[mnode[T]]
+	value T
+}
+
+// 多生产者多消费者无锁队列(Michael-Scott)
+type MQueue[T any] struct {
+	head  atomic.Pointer[mnode[T]]
+	tail  atomic.Pointer[mnode[T]]
+	count int32
+}
+
+func NewMQueue[T any]() *MQueue[T] {
+	nn := new(mnode[T])
+	ret := &MQueue[T]{}
+	ret.head.Store(nn)
+	ret.tail.Store(nn)
+	return ret
+}
+
+func (d *MQueue[T]) GetCount() int32 {
+	return atomic.LoadInt32(&d.count)
+}
+
+func (d *MQueue[T]) Push(val T) {
+	addNode := &mnode[T]{value: val}
+	d.link(addNode, addNode, 1)
+}
+
+// 批量入队, 元素保持连续
+func (d *MQueue[T]) PushBatch(vals ...T) {
+	if len(vals) <= 0 {
+		return
+	}
+	nodes := make([]mnode[T], len(vals))
+	for i := range vals {
+		nodes[i].value = vals[i]
+		if i > 0 {
+			nodes[i-1].next.Store(&nodes[i])
+		}
+	}
+	d.link(&nodes[0], &nodes[len(nodes)-1], int32(len(nodes)))
+}
+
+func (d *MQueue[T]) link(first, last *mnode[T], count int32) {
+	for {
+		tail := d.tail.Load()
+		next := tail.next.Load()
+		if tail != d.tail.Load() {
+			continue
+		}
+		if next != nil {
+			d.tail.CompareAndSwap(tail, next)
+			continue
+		}
+		if tail.next.CompareAndSwap(nil, first) {
+			atomic.AddInt32(&d.count, count)
+			d.tail.CompareAndSwap(tail, last)
+			return
+		}
+	}
+}
+
+func (d *MQueue[T]) Pop() (ret T) {
+	ret, _ = d.pop()
+	return
+}
+
+func (d *MQueue[T]) pop() (ret T, ok bool) {
+	for {
+		head := d.head.Load()
+		tail := d.tail.Load()
+		next := head.next.Load()
+		if head != d.head.Load() {
+			continue
+		}
+		if next == nil {
+			return
+		}
+		if head == tail {
+			d.tail.CompareAndSwap(tail, next)
+			continue
+		}
+		if val := next.value; d.head.CompareAndSwap(head, next) {
+			atomic.AddInt32(&d.count, -1)
+			return val, true
+		}
+	}
+}
+
+// 查看队首元素但不出队, 并发出队时结果仅供参考
+func (d *MQueue[T]) Peek() (ret T) {
+	if next := d.head.Load().next.Load(); next != nil {
+		ret = next.value
+	}
+	return
+}
+
+// 最多出队n个元素, n<=0返回nil
+func (d *MQueue[T]) PopBatch(n int) []T {
+	if n <= 0 {
+		return nil
+	}
+	return d.popAppend(make([]T, 0, min(n, max(int(d.GetCount()), 0))), n)
+}
+
+// 出队全部元素并追加到rets
+func (d *MQueue[T]) Drain(rets []T) []T {
+	return d.popAppend(rets, -1)
+}
+
+func (d *MQueue[T]) popAppend(rets []T, n int) []T {
+	for ; n != 0; n-- {
+		val, ok := d.pop()
+		if !ok {
+			break
+		}
+		rets = append(rets, val)
+	}
+	return rets
+}
@@ -0,0 +1,167 @@
+package async
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// panic结构化记录
+type PanicRecord struct {
+	Value  any             // recover得到的值
+	Stack  []byte          // 调用栈文本
+	Frames []runtime.Frame // panic位置开始的调用帧
+	Id     uint64          // 执行器id, 0表示未知
+	Label  string          // 任务标签
+	Time   time.Time       // 发生时间
+	Count  int             // 限流窗口内合并的相同panic次数(含本次)
+}
+
+// 发生panic的位置
+func (d *PanicRecord) Caller() string {
+	if len(d.Frames) <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", d.Frames[0].File, d.Frames[0].Line)
+}
+
+// panic处理器
+type IPanicHandler interface {
+	OnPanic(*PanicRecord)
+}
+
+type PanicFunc func(*PanicRecord)
+
+func (f PanicFunc) OnPanic(rec *PanicRecord) {
+	f(rec)
+}
+
+type panicLimit struct {
+	last  time.Time // 上次上报时间
+	count int       // 被抑制的次数
+}
+
+var (
+	handlerMutex sync.RWMutex
+	handlers     = map[*IPanicHandler]struct{}{}
+	limitMutex   sync.Mutex
+	limits       = map[string]*panicLimit{}
+	limitWindow  int64 // 相同panic限流窗口(纳秒), <=0不限流
+	repanic      int32 // 上报后重新panic
+)
+
+// 订阅panic记录, 返回取消订阅函数
+func Subscribe(h IPanicHandler) func() {
+	key := &h
+	handlerMutex.Lock()
+	handlers[key] = struct{}{}
+	handlerMutex.Unlock()
+	return func() {
+		handlerMutex.Lock()
+		delete(handlers, key)
+		handlerMutex.Unlock()
+	}
+}
+
+// 设置限流窗口, 相同值且相同位置的panic在窗口内只上报一次
+func SetPanicLimit(window time.Duration) {
+	limitMutex.Lock()
+	limits = map[string]*panicLimit{}
+	limitMutex.Unlock()
+	atomic.StoreInt64(&limitWindow, int64(window))
+}
+
+// 上报后重新panic使进程崩溃, 用于测试中暴露问题
+func SetRepanic(flag bool) {
+	var val int32
+	if flag {
+		val = 1
+	}
+	atomic.StoreInt32(&repanic, val)
+}
+
+// 为任务添加标签, panic记录中携带该标签
+func Label(label string, f func()) func() {
+	return func() {
+		defer func() {
+			if r := recover(); r != nil {
+				rec := newPanicRecord(r)
+				rec.Label = label
+				panic(rec)
+			}
+		}()
+		f()
+	}
+}
+
+func newPanicRecord(r any) *PanicRecord {
+	if rec, ok := r.(*PanicRecord); ok {
+		return rec
+	}
+	buf := make([]byte, 64<<10)
+	buf = buf[:runtime.Stack(buf, false)]
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(1, pcs)])
+	rets := []runtime.Frame{}
+	found := false
+	for {
+		frame, more := frames.Next()
+		if found {
+			rets = append(rets, frame)
+		} else if frame.Function == "runtime.gopanic" {
+			found = true
+		}
+		if !more {
+			break
+		}
+	}
+	return &PanicRecord{Value: r, Stack: buf, Frames: rets, Time: time.Now(), Count: 1}
+}
+
+// 限流判断, 返回是否需要上报
+func (d *PanicRecord) allow() bool {
+	window := atomic.LoadInt64(&limitWindow)
+	if window <= 0 {
+		return true
+	}
+	key := fmt.Sprintf("%v|%s", d.Value, d.Caller())
+	limitMutex.Lock()
+	defer limitMutex.Unlock()
+	item, ok := limits[key]
+	if !ok {
+		if len(limits) >= 1024 {
+			for k, v := range limits {
+				if d.Time.Sub(v.last) > time.Duration(window) {
+					delete(limits, k)
+				}
+			}
+		}
+		limits[key] = &panicLimit{last: d.Time}
+		return true
+	}
+	if d.Time.Sub(item.last) < time.Duration(window) {
+		item.count++
+		return false
+	}
+	d.Count += item.count
+	item.last, item.count = d.Time, 0
+	return true
+}
+
+func report(rec *PanicRecord) {
+	if rec.allow() {
+		if except != nil {
+			except("%v stack: %v", rec.Value, string(rec.Stack))
+		}
+		handlerMutex.RLock()
+		for h := range handlers {
+			(*h).OnPanic(rec)
+		}
+		handlerMutex.RUnlock()
+	}
+	if atomic.LoadInt32(&repanic) > 0 {
+		panic(rec.Value)
+	}
+}
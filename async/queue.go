@@ -10,6 +10,7 @@ type node[T any] struct {
 	value T
 }
 
+// 多生产者单消费者无锁队列, Pop/Peek/PopBatch/Drain只允许单个协程调用
 type Queue[T any] struct {
 	head  *node[T]
 	tail  *node[T]
@@ -28,17 +29,82 @@ func (d *Queue[T]) GetCount() int32 {
 func (d *Queue[T]) Push(val T) {
 	addNode := new(node[T])
 	addNode.value = val
-	prevNode := (*node[T])(atomic.SwapPointer((*unsafe.Pointer)(unsafe.Pointer(&d.tail)), unsafe.Pointer(addNode)))
-	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&prevNode.next)), unsafe.Pointer(addNode))
-	atomic.AddInt32(&d.count, 1)
+	d.link(addNode, addNode, 1)
+}
+
+// 批量入队, 只需一次原子交换
+func (d *Queue[T]) PushBatch(vals ...T) {
+	if len(vals) <= 0 {
+		return
+	}
+	nodes := make([]node[T], len(vals))
+	for i := range vals {
+		nodes[i].value = vals[i]
+		if i > 0 {
+			nodes[i-1].next = &nodes[i]
+		}
+	}
+	d.link(&nodes[0], &nodes[len(nodes)-1], int32(len(nodes)))
+}
+
+func (d *Queue[T]) link(first, last *node[T], count int32) {
+	prevNode := (*node[T])(atomic.SwapPointer((*unsafe.Pointer)(unsafe.Pointer(&d.tail)), unsafe.Pointer(last)))
+	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&prevNode.next)), unsafe.Pointer(first))
+	atomic.AddInt32(&d.count, count)
+}
+
+func (d *Queue[T]) next() *node[T] {
+	return (*node[T])(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&d.head.next))))
 }
 
 func (d *Queue[T]) Pop() (ret T) {
-	if node := (*node[T])(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&d.head.next)))); node != nil {
+	if node := d.next(); node != nil {
 		atomic.AddInt32(&d.count, -1)
+		ret = d.shift(node)
+	}
+	return
+}
+
+// 出队后node成为新的头节点, 清空其值避免批量节点数组持有已出队的值
+func (d *Queue[T]) shift(node *node[T]) (ret T) {
+	var zero T
+	ret = node.value
+	node.value = zero
+	d.head.next = nil
+	d.head = node
+	return
+}
+
+// 查看队首元素但不出队
+func (d *Queue[T]) Peek() (ret T) {
+	if node := d.next(); node != nil {
 		ret = node.value
-		d.head.next = nil
-		d.head = node
 	}
 	return
 }
+
+// 最多出队n个元素, n<=0返回nil
+func (d *Queue[T]) PopBatch(n int) []T {
+	if n <= 0 {
+		return nil
+	}
+	return d.popAppend(make([]T, 0, min(n, max(int(d.GetCount()), 0))), n)
+}
+
+// 出队全部元素并追加到rets
+func (d *Queue[T]) Drain(rets []T) []T {
+	return d.popAppend(rets, -1)
+}
+
+func (d *Queue[T]) popAppend(rets []T, n int) []T {
+	count := int32(0)
+	for node := d.next(); node != nil && n != 0; node = d.next() {
+		rets = append(rets, d.shift(node))
+		count++
+		n--
+	}
+	if count > 0 {
+		atomic.AddInt32(&d.count, -count)
+	}
+	return rets
+}
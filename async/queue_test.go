@@ -0,0 +1,159 @@
+package async
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestQueueBatch(t *testing.T) {
+	qq := NewQueue[int]()
+	qq.PushBatch(1, 2, 3)
+	qq.Push(4)
+	qq.PushBatch(5, 6)
+	if qq.GetCount() != 6 || qq.Peek() != 1 {
+		t.Fatalf("count: %d, peek: %d", qq.GetCount(), qq.Peek())
+	}
+	if rets := qq.PopBatch(2); len(rets) != 2 || rets[0] != 1 || rets[1] != 2 {
+		t.Fatalf("rets: %v", rets)
+	}
+	if qq.PopBatch(0) != nil || qq.PopBatch(-1) != nil || NewMQueue[int]().PopBatch(-1) != nil {
+		t.Fatal("expect nil batch")
+	}
+	if val := qq.Pop(); val != 3 {
+		t.Fatalf("val: %d", val)
+	}
+	if rets := qq.Drain(nil); len(rets) != 3 || rets[0] != 4 || rets[2] != 6 {
+		t.Fatalf("rets: %v", rets)
+	}
+	if qq.GetCount() != 0 || qq.Pop() != 0 {
+		t.Fatal("expect empty")
+	}
+}
+
+func TestQueueMPSC(t *testing.T) {
+	qq := NewQueue[int]()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				if j%2 == 0 {
+					qq.Push(i*1000 + j + 1)
+				} else {
+					qq.PushBatch(i*1000 + j + 1)
+				}
+			}
+		}()
+	}
+	total := 0
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	rets := []int{}
+	for total < 8000 {
+		rets = qq.Drain(rets[:0])
+		total += len(rets)
+		select {
+		case <-done:
+			total += len(qq.Drain(rets[:0]))
+		default:
+		}
+	}
+	if total != 8000 {
+		t.Fatalf("total: %d", total)
+	}
+}
+
+func TestMQueue(t *testing.T) {
+	qq := NewMQueue[int]()
+	producers := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		producers.Add(1)
+		go func() {
+			defer producers.Done()
+			for j := 0; j < 1000; j += 2 {
+				qq.PushBatch(i*1000+j+1, i*1000+j+2)
+			}
+		}()
+	}
+	seen := make([]int32, 8001)
+	consumers := sync.WaitGroup{}
+	done := make(chan struct{})
+	mutex := sync.Mutex{}
+	for i := 0; i < 4; i++ {
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			for {
+				rets := qq.PopBatch(16)
+				mutex.Lock()
+				for _, val := range rets {
+					seen[val]++
+				}
+				mutex.Unlock()
+				if len(rets) > 0 {
+					continue
+				}
+				select {
+				case <-done:
+					if qq.GetCount() <= 0 {
+						return
+					}
+				default:
+				}
+			}
+		}()
+	}
+	producers.Wait()
+	close(done)
+	consumers.Wait()
+	for val := 1; val <= 8000; val++ {
+		if seen[val] != 1 {
+			t.Fatalf("val: %d, seen: %d", val, seen[val])
+		}
+	}
+}
+
+func BenchmarkQueue(b *testing.B) {
+	qq := NewQueue[int]()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			qq.Push(1)
+		}
+	})
+	qq.Drain(nil)
+}
+
+func BenchmarkQueueBatch(b *testing.B) {
+	qq := NewQueue[int]()
+	vals := make([]int, 16)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			qq.PushBatch(vals...)
+		}
+	})
+	qq.Drain(nil)
+}
+
+func BenchmarkMQueue(b *testing.B) {
+	qq := NewMQueue[int]()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			qq.Push(1)
+			qq.Pop()
+		}
+	})
+}
+
+func BenchmarkChannel(b *testing.B) {
+	ch := make(chan int, 1024)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			ch <- 1
+			<-ch
+		}
+	})
+}
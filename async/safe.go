@@ -1,13 +1,24 @@
 package async
 
 import (
-	"runtime/debug"
+	"fmt"
 )
 
 var (
 	except func(string, ...any)
 )
 
+// 任务panic转换的错误
+type PanicError struct {
+	Value  any          // recover得到的值
+	Stack  []byte       // 调用栈
+	Record *PanicRecord // 结构化记录
+}
+
+func (d *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", d.Value)
+}
+
 func Except(e func(string, ...any)) {
 	except = e
 }
@@ -19,10 +30,26 @@ func Go(f func()) {
 }
 
 func Recover(f func()) {
+	CatchId(0, f)
+}
+
+// 执行任务, panic时上报并以*PanicError返回
+func Catch(f func()) error {
+	return CatchId(0, f)
+}
+
+// 执行任务, panic记录中携带执行器id
+func CatchId(id uint64, f func()) (err error) {
 	defer func() {
-		if err := recover(); err != nil && except != nil {
-			except("%v stack: %v", err, string(debug.Stack()))
+		if r := recover(); r != nil {
+			rec := newPanicRecord(r)
+			if rec.Id == 0 {
+				rec.Id = id
+			}
+			err = &PanicError{Value: rec.Value, Stack: rec.Stack, Record: rec}
+			report(rec)
 		}
 	}()
 	f()
+	return
 }
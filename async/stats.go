@@ -0,0 +1,155 @@
+package async
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	pkgPrefix = "github.com/hechh/library/async."
+)
+
+var (
+	statsMap = sync.Map{} // 所有启用统计的执行器 *Stats => struct{}
+)
+
+type iSource interface {
+	GetId() uint64
+	GetCount() int32
+}
+
+// 慢任务信息
+type SlowTask struct {
+	Name   string        // 执行器名称
+	Id     uint64        // 执行器id
+	Caller string        // 提交任务的调用位置
+	Wait   time.Duration // 排队耗时
+	Run    time.Duration // 执行耗时
+}
+
+// 执行器运行统计
+type Stats struct {
+	name      string
+	source    iSource
+	inflight  int64
+	completed uint64
+	panicked  uint64
+	waits     Histogram
+	runs      Histogram
+	slow      time.Duration
+	onSlow    func(*SlowTask)
+}
+
+type StatsSnapshot struct {
+	Name      string            `json:"name"`
+	Id        uint64            `json:"id"`
+	Queued    int32             `json:"queued"`
+	InFlight  int64             `json:"in_flight"`
+	Completed uint64            `json:"completed"`
+	Panicked  uint64            `json:"panicked"`
+	Waits     HistogramSnapshot `json:"waits"`
+	Runs      HistogramSnapshot `json:"runs"`
+}
+
+func newStats(name string, source iSource) *Stats {
+	ret := &Stats{name: name, source: source}
+	statsMap.Store(ret, struct{}{})
+	return ret
+}
+
+// 遍历所有存活执行器的统计
+func RangeStats(f func(*Stats) bool) {
+	statsMap.Range(func(key, _ any) bool {
+		return f(key.(*Stats))
+	})
+}
+
+// 所有存活执行器的统计快照, 可用于调试接口
+func GetAllStats() (rets []StatsSnapshot) {
+	RangeStats(func(st *Stats) bool {
+		rets = append(rets, st.Snapshot())
+		return true
+	})
+	return
+}
+
+func (d *Stats) close() {
+	if d != nil {
+		statsMap.Delete(d)
+	}
+}
+
+func (d *Stats) GetName() string {
+	return d.name
+}
+
+// 设置慢任务阈值及回调(需在Start之前调用), 回调在执行任务的协程上调用
+func (d *Stats) SetSlow(threshold time.Duration, f func(*SlowTask)) {
+	d.slow = threshold
+	d.onSlow = f
+}
+
+func (d *Stats) Snapshot() StatsSnapshot {
+	return StatsSnapshot{
+		Name:      d.name,
+		Id:        d.source.GetId(),
+		Queued:    d.source.GetCount(),
+		InFlight:  atomic.LoadInt64(&d.inflight),
+		Completed: atomic.LoadUint64(&d.completed),
+		Panicked:  atomic.LoadUint64(&d.panicked),
+		Waits:     d.waits.Snapshot(),
+		Runs:      d.runs.Snapshot(),
+	}
+}
+
+// 包装任务以记录排队和执行耗时
+func (d *Stats) wrap(f func()) func() {
+	var pcs []uintptr
+	if d.slow > 0 && d.onSlow != nil {
+		pcs = make([]uintptr, 16)
+		pcs = pcs[:runtime.Callers(3, pcs)]
+	}
+	pushed := time.Now()
+	return func() {
+		start := time.Now()
+		atomic.AddInt64(&d.inflight, 1)
+		err := CatchId(d.source.GetId(), f)
+		end := time.Now()
+		atomic.AddInt64(&d.inflight, -1)
+		atomic.AddUint64(&d.completed, 1)
+		if err != nil {
+			atomic.AddUint64(&d.panicked, 1)
+		}
+		wait, run := start.Sub(pushed), end.Sub(start)
+		d.waits.Observe(wait)
+		d.runs.Observe(run)
+		if pcs != nil && run >= d.slow {
+			d.onSlow(&SlowTask{
+				Name:   d.name,
+				Id:     d.source.GetId(),
+				Caller: callerSite(pcs),
+				Wait:   wait,
+				Run:    run,
+			})
+		}
+	}
+}
+
+// 跳过本包内部调用, 返回第一个外部调用位置
+func callerSite(pcs []uintptr) string {
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, pkgPrefix) || strings.HasSuffix(frame.File, "_test.go") {
+			return fmt.Sprintf("%s:%d %s", path.Base(frame.File), frame.Line, path.Base(frame.Function))
+		}
+		if !more {
+			return ""
+		}
+	}
+}
@@ -38,6 +38,8 @@ func GobEncrypto(args ...any) ([]byte, error) {
 	item := gobEncoder.Get().(*GobEncoder)
 	defer gobEncoder.Put(item)
 	item.buf.Reset()
+	// 每次使用新的编码器, 保证结果自带类型信息, 可以跨进程解码
+	item.enc = gob.NewEncoder(item.buf)
 	for _, arg := range args {
 		if err := item.enc.Encode(arg); err != nil {
 			return nil, err
@@ -54,6 +56,7 @@ func GobDecrypto(data []byte, args ...any) error {
 	defer gobDecoder.Put(item)
 	item.buf.Reset()
 	item.buf.Write(data)
+	item.dec = gob.NewDecoder(item.buf)
 	for _, arg := range args {
 		if err := item.dec.Decode(arg); err != nil {
 			return err
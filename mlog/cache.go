@@ -7,10 +7,12 @@ import (
 )
 
 type Cache struct {
-	n    int
-	size int
-	buff []byte
-	fp   *os.File
+	n       int
+	size    int
+	buff    []byte
+	fp      *os.File
+	name    string // 当前文件名
+	written int64  // 当前文件大小(含未刷盘部分)
 }
 
 func NewCache(size int) *Cache {
@@ -32,12 +34,30 @@ func (d *Cache) Set(filename string) error {
 		if err != nil {
 			return err
 		}
-		d.fp = fp
+		d.fp, d.name, d.written = fp, filename, 0
+		if st, err := fp.Stat(); err == nil {
+			d.written = st.Size()
+		}
 	}
 	return nil
 }
 
+// 当前文件名
+func (d *Cache) Name() string {
+	return d.name
+}
+
+// 当前文件大小(含未刷盘部分)
+func (d *Cache) Size() int64 {
+	return d.written
+}
+
 func (d *Cache) Write(buf []byte) error {
+	d.written += int64(len(buf))
+	return d.write(buf)
+}
+
+func (d *Cache) write(buf []byte) error {
 	diff := d.size - d.n
 	if ll := len(buf); ll <= diff {
 		copy(d.buff[d.n:], buf)
@@ -51,7 +71,7 @@ func (d *Cache) Write(buf []byte) error {
 	if err := d.Flush(); err != nil {
 		return err
 	}
-	return d.Write(buf[diff:])
+	return d.write(buf[diff:])
 }
 
 func (d *Cache) Flush() error {
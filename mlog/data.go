@@ -1,21 +1,22 @@
 package mlog
 
 import (
-	"bytes"
-	"path/filepath"
-	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
 type Data struct {
-	buffer    *bytes.Buffer
+	mutex     sync.Mutex // 保护文本的延迟编码, 多个输出可能并发读取
+	encoded   bool       // buffer是否已编码
+	buffer    []byte
 	time      time.Time
+	meta      Meta
 	reference int32
 }
 
 func NewData() IData {
-	return &Data{buffer: bytes.NewBuffer(nil)}
+	return &Data{}
 }
 
 func (d *Data) Now() time.Time {
@@ -30,27 +31,25 @@ func (d *Data) Done() int32 {
 	return atomic.AddInt32(&d.reference, -1)
 }
 
+// 默认文本格式的日志, 首次读取时编码, 只使用GetMeta的输出不产生编码开销
 func (d *Data) Read() []byte {
-	return d.buffer.Bytes()
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if !d.encoded {
+		d.buffer = defaultEncoder.Encode(d.buffer[:0], d.time, &d.meta)
+		d.encoded = true
+	}
+	return d.buffer
+}
+
+func (d *Data) GetMeta() *Meta {
+	return &d.meta
 }
 
 func (d *Data) Write(data Meta) {
-	d.buffer.Reset()
+	// 复用字段切片, 避免引用调用方的数据
+	data.Fields = append(d.meta.Fields[:0], data.Fields...)
+	d.meta = data
 	d.time = time.Now()
-	d.buffer.WriteByte('[')
-	d.buffer.WriteString(d.time.Format("2006-01-02 15:04:05.000"))
-	d.buffer.WriteByte(']')
-	d.buffer.WriteByte('\t')
-	d.buffer.WriteByte('[')
-	d.buffer.WriteString(LevelToString(data.Level))
-	d.buffer.WriteByte(']')
-	d.buffer.WriteByte('\t')
-	d.buffer.WriteString(filepath.Base(data.FileName))
-	d.buffer.WriteByte(':')
-	d.buffer.WriteString(strconv.Itoa(data.Line))
-	d.buffer.WriteByte(' ')
-	d.buffer.WriteString(data.FuncName)
-	d.buffer.WriteByte('\t')
-	d.buffer.WriteString(data.Msg)
-	d.buffer.WriteByte('\n')
+	d.encoded = false
 }
@@ -0,0 +1,274 @@
+package mlog
+
+import (
+	"encoding/json"
+	"math"
+	"path/filepath"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// 日志编码器, 每个输出可以使用不同的编码器
+type IEncoder interface {
+	Encode(buf []byte, tt time.Time, meta *Meta) []byte // 追加一行日志(含换行)
+}
+
+// 编码配置, 零值字段使用默认值, 键名只对JSON和logfmt有效
+type EncoderConfig struct {
+	TimeFormat string // 时间格式, 默认"2006-01-02 15:04:05.000"
+	TimeKey    string // 默认time
+	LevelKey   string // 默认level
+	CallerKey  string // 默认caller
+	FuncKey    string // 默认func
+	MsgKey     string // 默认msg
+}
+
+var (
+	defaultEncoder = NewTextEncoder(nil)
+	levelColors    = map[int32]string{
+		LOG_TRACE: "\x1b[90m",
+		LOG_DEBUG: "\x1b[36m",
+		LOG_INFO:  "\x1b[32m",
+		LOG_WARN:  "\x1b[33m",
+		LOG_ERROR: "\x1b[31m",
+		LOG_FATAL: "\x1b[35m",
+	}
+)
+
+const (
+	colorReset = "\x1b[0m"
+	colorKey   = "\x1b[2m"
+)
+
+func newEncoderConfig(cfg *EncoderConfig) EncoderConfig {
+	ret := EncoderConfig{}
+	if cfg != nil {
+		ret = *cfg
+	}
+	ret.TimeFormat = orDefault(ret.TimeFormat, "2006-01-02 15:04:05.000")
+	ret.TimeKey = orDefault(ret.TimeKey, "time")
+	ret.LevelKey = orDefault(ret.LevelKey, "level")
+	ret.CallerKey = orDefault(ret.CallerKey, "caller")
+	ret.FuncKey = orDefault(ret.FuncKey, "func")
+	ret.MsgKey = orDefault(ret.MsgKey, "msg")
+	return ret
+}
+
+func orDefault(val, def string) string {
+	if len(val) <= 0 {
+		return def
+	}
+	return val
+}
+
+func appendCaller(buf []byte, meta *Meta) []byte {
+	buf = append(buf, filepath.Base(meta.FileName)...)
+	buf = append(buf, ':')
+	return strconv.AppendInt(buf, int64(meta.Line), 10)
+}
+
+// 文本格式: [时间]	[级别]	文件:行号 函数	消息	k=v k=v
+type TextEncoder struct {
+	cfg EncoderConfig
+}
+
+func NewTextEncoder(cfg *EncoderConfig) *TextEncoder {
+	return &TextEncoder{cfg: newEncoderConfig(cfg)}
+}
+
+func (d *TextEncoder) Encode(buf []byte, tt time.Time, meta *Meta) []byte {
+	buf = append(buf, '[')
+	buf = tt.AppendFormat(buf, d.cfg.TimeFormat)
+	buf = append(buf, "]\t["...)
+	buf = append(buf, LevelToString(meta.Level)...)
+	buf = append(buf, "]\t"...)
+	buf = appendCaller(buf, meta)
+	buf = append(buf, ' ')
+	buf = append(buf, meta.FuncName...)
+	buf = append(buf, '\t')
+	buf = append(buf, meta.Msg...)
+	for i, ff := range meta.Fields {
+		if i == 0 {
+			buf = append(buf, '\t')
+		} else {
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, ff.Key...)
+		buf = append(buf, '=')
+		buf = ff.AppendText(buf)
+	}
+	return append(buf, '\n')
+}
+
+// 彩色控制台格式, 用于调试
+type ConsoleEncoder struct {
+	cfg EncoderConfig
+}
+
+func NewConsoleEncoder(cfg *EncoderConfig) *ConsoleEncoder {
+	return &ConsoleEncoder{cfg: newEncoderConfig(cfg)}
+}
+
+func (d *ConsoleEncoder) Encode(buf []byte, tt time.Time, meta *Meta) []byte {
+	buf = tt.AppendFormat(buf, d.cfg.TimeFormat)
+	buf = append(buf, ' ')
+	buf = append(buf, levelColors[meta.Level]...)
+	buf = append(buf, LevelToString(meta.Level)...)
+	buf = append(buf, colorReset...)
+	buf = append(buf, ' ')
+	buf = appendCaller(buf, meta)
+	buf = append(buf, ' ')
+	buf = append(buf, meta.FuncName...)
+	buf = append(buf, ' ')
+	buf = append(buf, meta.Msg...)
+	for _, ff := range meta.Fields {
+		buf = append(buf, ' ')
+		buf = append(buf, colorKey...)
+		buf = append(buf, ff.Key...)
+		buf = append(buf, '=')
+		buf = append(buf, colorReset...)
+		buf = ff.AppendText(buf)
+	}
+	return append(buf, '\n')
+}
+
+// logfmt格式: time=... level=INFO caller=file:line func=... msg=... k=v
+type LogfmtEncoder struct {
+	cfg EncoderConfig
+}
+
+func NewLogfmtEncoder(cfg *EncoderConfig) *LogfmtEncoder {
+	return &LogfmtEncoder{cfg: newEncoderConfig(cfg)}
+}
+
+func (d *LogfmtEncoder) Encode(buf []byte, tt time.Time, meta *Meta) []byte {
+	buf = append(buf, d.cfg.TimeKey...)
+	buf = append(buf, '=')
+	buf = appendString(buf, tt.Format(d.cfg.TimeFormat))
+	buf = append(buf, ' ')
+	buf = append(buf, d.cfg.LevelKey...)
+	buf = append(buf, '=')
+	buf = append(buf, LevelToString(meta.Level)...)
+	if len(meta.FileName) > 0 {
+		buf = append(buf, ' ')
+		buf = append(buf, d.cfg.CallerKey...)
+		buf = append(buf, '=')
+		buf = appendCaller(buf, meta)
+		buf = append(buf, ' ')
+		buf = append(buf, d.cfg.FuncKey...)
+		buf = append(buf, '=')
+		buf = appendString(buf, meta.FuncName)
+	}
+	buf = append(buf, ' ')
+	buf = append(buf, d.cfg.MsgKey...)
+	buf = append(buf, '=')
+	buf = appendString(buf, meta.Msg)
+	for _, ff := range meta.Fields {
+		buf = append(buf, ' ')
+		buf = append(buf, ff.Key...)
+		buf = append(buf, '=')
+		buf = ff.AppendText(buf)
+	}
+	return append(buf, '\n')
+}
+
+// JSON格式, 每行一个对象
+type JSONEncoder struct {
+	cfg EncoderConfig
+}
+
+func NewJSONEncoder(cfg *EncoderConfig) *JSONEncoder {
+	return &JSONEncoder{cfg: newEncoderConfig(cfg)}
+}
+
+func (d *JSONEncoder) Encode(buf []byte, tt time.Time, meta *Meta) []byte {
+	buf = append(buf, '{')
+	buf = appendJSONKey(buf, d.cfg.TimeKey, true)
+	buf = appendJSONString(buf, tt.Format(d.cfg.TimeFormat))
+	buf = appendJSONKey(buf, d.cfg.LevelKey, false)
+	buf = appendJSONString(buf, LevelToString(meta.Level))
+	if len(meta.FileName) > 0 {
+		buf = appendJSONKey(buf, d.cfg.CallerKey, false)
+		buf = append(buf, '"')
+		buf = appendCaller(buf, meta)
+		buf = append(buf, '"')
+		buf = appendJSONKey(buf, d.cfg.FuncKey, false)
+		buf = appendJSONString(buf, meta.FuncName)
+	}
+	buf = appendJSONKey(buf, d.cfg.MsgKey, false)
+	buf = appendJSONString(buf, meta.Msg)
+	for _, ff := range meta.Fields {
+		buf = appendJSONKey(buf, ff.Key, false)
+		buf = appendJSONValue(buf, ff)
+	}
+	return append(buf, '}', '\n')
+}
+
+func appendJSONKey(buf []byte, key string, first bool) []byte {
+	if !first {
+		buf = append(buf, ',')
+	}
+	buf = appendJSONString(buf, key)
+	return append(buf, ':')
+}
+
+func appendJSONValue(buf []byte, ff Field) []byte {
+	switch ff.Type {
+	case FIELD_BOOL:
+		return strconv.AppendBool(buf, ff.Int != 0)
+	case FIELD_INT:
+		return strconv.AppendInt(buf, ff.Int, 10)
+	case FIELD_UINT:
+		return strconv.AppendUint(buf, uint64(ff.Int), 10)
+	case FIELD_FLOAT:
+		if math.IsInf(ff.Float, 0) || math.IsNaN(ff.Float) {
+			return appendJSONString(buf, strconv.FormatFloat(ff.Float, 'g', -1, 64))
+		}
+		return strconv.AppendFloat(buf, ff.Float, 'g', -1, 64)
+	case FIELD_STRING:
+		return appendJSONString(buf, ff.Str)
+	case FIELD_ANY:
+		if data, err := json.Marshal(ff.Any); err == nil {
+			return append(buf, data...)
+		}
+	}
+	// 其余类型使用文本形式
+	var tmp [64]byte
+	return appendJSONString(buf, string(ff.AppendText(tmp[:0])))
+}
+
+const hexChars = "0123456789abcdef"
+
+func appendJSONString(buf []byte, str string) []byte {
+	buf = append(buf, '"')
+	for i := 0; i < len(str); {
+		cc := str[i]
+		if cc < utf8.RuneSelf {
+			switch {
+			case cc == '"' || cc == '\\':
+				buf = append(buf, '\\', cc)
+			case cc == '\n':
+				buf = append(buf, '\\', 'n')
+			case cc == '\r':
+				buf = append(buf, '\\', 'r')
+			case cc == '\t':
+				buf = append(buf, '\\', 't')
+			case cc < 0x20:
+				buf = append(buf, '\\', 'u', '0', '0', hexChars[cc>>4], hexChars[cc&0xf])
+			default:
+				buf = append(buf, cc)
+			}
+			i++
+			continue
+		}
+		rr, size := utf8.DecodeRuneInString(str[i:])
+		if rr == utf8.RuneError && size == 1 {
+			buf = append(buf, `�`...)
+		} else {
+			buf = append(buf, str[i:i+size]...)
+		}
+		i += size
+	}
+	return append(buf, '"')
+}
@@ -0,0 +1,197 @@
+package mlog
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 字段类型
+const (
+	FIELD_ANY      = 0
+	FIELD_BOOL     = 1
+	FIELD_INT      = 2
+	FIELD_UINT     = 3
+	FIELD_FLOAT    = 4
+	FIELD_STRING   = 5
+	FIELD_DURATION = 6
+	FIELD_TIME     = 7
+	FIELD_ERROR    = 8
+)
+
+// 结构化日志字段, 基础类型不装箱
+type Field struct {
+	Key   string
+	Type  int32
+	Int   int64
+	Str   string
+	Float float64
+	Any   any
+}
+
+func Bool(key string, val bool) Field {
+	ret := Field{Key: key, Type: FIELD_BOOL}
+	if val {
+		ret.Int = 1
+	}
+	return ret
+}
+
+func Int(key string, val int) Field {
+	return Field{Key: key, Type: FIELD_INT, Int: int64(val)}
+}
+
+func Int64(key string, val int64) Field {
+	return Field{Key: key, Type: FIELD_INT, Int: val}
+}
+
+func Uint64(key string, val uint64) Field {
+	return Field{Key: key, Type: FIELD_UINT, Int: int64(val)}
+}
+
+func Float64(key string, val float64) Field {
+	return Field{Key: key, Type: FIELD_FLOAT, Float: val}
+}
+
+func String(key string, val string) Field {
+	return Field{Key: key, Type: FIELD_STRING, Str: val}
+}
+
+func Duration(key string, val time.Duration) Field {
+	return Field{Key: key, Type: FIELD_DURATION, Int: int64(val)}
+}
+
+func Time(key string, val time.Time) Field {
+	return Field{Key: key, Type: FIELD_TIME, Any: val}
+}
+
+// key固定为error, err为nil时值为空
+func Err(err error) Field {
+	if err == nil {
+		return Field{Key: "error", Type: FIELD_STRING}
+	}
+	return Field{Key: "error", Type: FIELD_ERROR, Any: err}
+}
+
+// 按值的实际类型生成字段
+func Any(key string, val any) Field {
+	switch vv := val.(type) {
+	case Field:
+		return vv
+	case bool:
+		return Bool(key, vv)
+	case int:
+		return Int64(key, int64(vv))
+	case int8:
+		return Int64(key, int64(vv))
+	case int16:
+		return Int64(key, int64(vv))
+	case int32:
+		return Int64(key, int64(vv))
+	case int64:
+		return Int64(key, vv)
+	case uint:
+		return Uint64(key, uint64(vv))
+	case uint8:
+		return Uint64(key, uint64(vv))
+	case uint16:
+		return Uint64(key, uint64(vv))
+	case uint32:
+		return Uint64(key, uint64(vv))
+	case uint64:
+		return Uint64(key, vv)
+	case float32:
+		return Float64(key, float64(vv))
+	case float64:
+		return Float64(key, vv)
+	case string:
+		return String(key, vv)
+	case time.Duration:
+		return Duration(key, vv)
+	case time.Time:
+		return Time(key, vv)
+	case error:
+		return Field{Key: key, Type: FIELD_ERROR, Any: vv}
+	}
+	return Field{Key: key, Type: FIELD_ANY, Any: val}
+}
+
+// 将"key", value交替的参数转换成字段, 参数本身是Field时直接使用
+func toFields(kvs []any) []Field {
+	if len(kvs) <= 0 {
+		return nil
+	}
+	rets := make([]Field, 0, len(kvs)/2+1)
+	for i := 0; i < len(kvs); i++ {
+		if ff, ok := kvs[i].(Field); ok {
+			rets = append(rets, ff)
+			continue
+		}
+		key, ok := kvs[i].(string)
+		if !ok || i+1 >= len(kvs) {
+			// 缺少key或value
+			rets = append(rets, Any("!BADKEY", kvs[i]))
+			continue
+		}
+		rets = append(rets, Any(key, kvs[i+1]))
+		i++
+	}
+	return rets
+}
+
+// 字段的原始值
+func (d Field) Value() any {
+	switch d.Type {
+	case FIELD_BOOL:
+		return d.Int != 0
+	case FIELD_INT:
+		return d.Int
+	case FIELD_UINT:
+		return uint64(d.Int)
+	case FIELD_FLOAT:
+		return d.Float
+	case FIELD_STRING:
+		return d.Str
+	case FIELD_DURATION:
+		return time.Duration(d.Int)
+	case FIELD_ERROR:
+		return d.Any.(error).Error()
+	}
+	return d.Any
+}
+
+// 追加字段值的文本形式
+func (d Field) AppendText(buf []byte) []byte {
+	switch d.Type {
+	case FIELD_BOOL:
+		return strconv.AppendBool(buf, d.Int != 0)
+	case FIELD_INT:
+		return strconv.AppendInt(buf, d.Int, 10)
+	case FIELD_UINT:
+		return strconv.AppendUint(buf, uint64(d.Int), 10)
+	case FIELD_FLOAT:
+		if math.IsInf(d.Float, 0) || math.IsNaN(d.Float) {
+			return strconv.AppendQuote(buf, strconv.FormatFloat(d.Float, 'g', -1, 64))
+		}
+		return strconv.AppendFloat(buf, d.Float, 'g', -1, 64)
+	case FIELD_STRING:
+		return appendString(buf, d.Str)
+	case FIELD_DURATION:
+		return append(buf, time.Duration(d.Int).String()...)
+	case FIELD_TIME:
+		return d.Any.(time.Time).AppendFormat(buf, time.RFC3339Nano)
+	case FIELD_ERROR:
+		return appendString(buf, d.Any.(error).Error())
+	}
+	return appendString(buf, fmt.Sprint(d.Any))
+}
+
+// 包含空白、引号或等号时加引号
+func appendString(buf []byte, str string) []byte {
+	if len(str) <= 0 || strings.ContainsAny(str, " \t\r\n\"=") {
+		return strconv.AppendQuote(buf, str)
+	}
+	return append(buf, str...)
+}
@@ -0,0 +1,159 @@
+package mlog
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hechh/library/uerror"
+)
+
+// 批量POST到日志收集服务, 默认JSON行格式
+// 满batch条或每interval发送一次, 失败后重试, 缓冲满或关闭时丢弃新日志
+type HTTPWriter struct {
+	sync.WaitGroup
+	url      string
+	client   *http.Client
+	encoder  IEncoder
+	batch    int
+	interval time.Duration
+	retry    int // 失败重试次数
+	buffer   []byte
+	count    int // buffer中的日志条数
+	datas    chan IData
+	exit     chan struct{}
+	status   int32  // 1表示已关闭
+	dropped  uint64 // 丢弃的日志数
+}
+
+// size为缓冲的日志条数, interval<=0时默认1s
+func NewHTTPWriter(url string, batch int, interval time.Duration, size int) *HTTPWriter {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ret := &HTTPWriter{
+		url:      url,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		encoder:  NewJSONEncoder(nil),
+		batch:    max(batch, 1),
+		interval: interval,
+		retry:    3,
+		datas:    make(chan IData, max(size, 1)),
+		exit:     make(chan struct{}),
+	}
+	ret.Add(1)
+	go ret.run()
+	return ret
+}
+
+// 设置编码器, 需在Push之前调用
+func (d *HTTPWriter) SetEncoder(enc IEncoder) *HTTPWriter {
+	d.encoder = enc
+	return d
+}
+
+// 丢弃的日志数
+func (d *HTTPWriter) GetDropped() uint64 {
+	return atomic.LoadUint64(&d.dropped)
+}
+
+func (d *HTTPWriter) Push(data IData) {
+	if atomic.LoadInt32(&d.status) > 0 {
+		atomic.AddUint64(&d.dropped, 1)
+		put(data)
+		return
+	}
+	select {
+	case d.datas <- data:
+	default:
+		atomic.AddUint64(&d.dropped, 1)
+		put(data)
+	}
+}
+
+// 关闭并发送缓冲中的日志
+func (d *HTTPWriter) Close() {
+	if atomic.CompareAndSwapInt32(&d.status, 0, 1) {
+		close(d.exit)
+	}
+	d.Wait()
+}
+
+func (d *HTTPWriter) run() {
+	tt := time.NewTicker(d.interval)
+	defer func() {
+		tt.Stop()
+		d.Done()
+	}()
+	for {
+		select {
+		case data := <-d.datas:
+			d.add(data)
+			if d.count >= d.batch {
+				d.flush(true)
+			}
+		case <-tt.C:
+			d.flush(true)
+		case <-d.exit:
+			for {
+				select {
+				case data := <-d.datas:
+					d.add(data)
+					if d.count >= d.batch {
+						d.flush(false)
+					}
+				default:
+					d.flush(false)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (d *HTTPWriter) add(data IData) {
+	d.buffer = d.encoder.Encode(d.buffer, data.Now(), data.GetMeta())
+	d.count++
+	put(data)
+}
+
+// 发送一批日志, wait为true时重试前退避等待
+func (d *HTTPWriter) flush(wait bool) {
+	if d.count <= 0 {
+		return
+	}
+	backoff := minBackoff
+	for i := 0; i <= d.retry; i++ {
+		if d.post() == nil {
+			break
+		}
+		if i == d.retry {
+			atomic.AddUint64(&d.dropped, uint64(d.count))
+			break
+		}
+		if wait {
+			select {
+			case <-time.After(backoff):
+				backoff *= 2
+			case <-d.exit:
+				wait = false
+			}
+		}
+	}
+	d.buffer = d.buffer[:0]
+	d.count = 0
+}
+
+func (d *HTTPWriter) post() error {
+	rsp, err := d.client.Post(d.url, "application/x-ndjson", bytes.NewReader(d.buffer))
+	if err != nil {
+		return err
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		return uerror.New(-1, "日志发送失败: %s", rsp.Status)
+	}
+	return nil
+}
@@ -5,14 +5,18 @@ import (
 	"path"
 	"runtime"
 	"strings"
+	"sync"
 	"sync/atomic"
 
 	"github.com/spf13/cast"
 )
 
 type Logger struct {
-	level int32
-	list  []IWriter
+	level  int32
+	routes atomic.Pointer[[]*route] // 输出路由, 写时复制
+	mutex  sync.Mutex               // 保护路由的修改
+	parent *Logger                  // 子日志共享根日志的级别和输出
+	fields []Field                  // 上下文字段
 }
 
 func NewLogger(level any, ws ...IWriter) *Logger {
@@ -23,60 +27,174 @@ func NewLogger(level any, ws ...IWriter) *Logger {
 	default:
 		logLevel = cast.ToInt32(vv)
 	}
-	return &Logger{
-		level: logLevel,
-		list:  ws,
+	ret := &Logger{level: logLevel}
+	routes := make([]*route, 0, len(ws))
+	for _, w := range ws {
+		routes = append(routes, &route{writer: w})
 	}
+	ret.routes.Store(&routes)
+	return ret
 }
 
+// 关闭输出, 子日志不拥有输出, 调用无效
 func (d *Logger) Close() {
-	for _, w := range d.list {
-		w.Close()
+	if d.parent != nil {
+		return
+	}
+	for _, rr := range *d.routes.Load() {
+		rr.writer.Close()
 	}
 }
 
-func (d *Logger) SetLevel(level int32) {
+// 添加输出, 可在运行时调用, 只输出不低于level且满足所有过滤条件的日志
+// 注意: 低于Logger级别的日志在进入路由前已被过滤
+func (d *Logger) AddWriter(w IWriter, level int32, filters ...IFilter) {
+	root := d.root()
+	root.mutex.Lock()
+	defer root.mutex.Unlock()
+	olds := *root.routes.Load()
+	news := make([]*route, 0, len(olds)+1)
+	news = append(news, olds...)
+	news = append(news, &route{writer: w, level: level, filters: filters, added: true})
+	root.routes.Store(&news)
+}
+
+// 移除输出, 可在运行时调用, 不会关闭w(移除时可能仍有正在进行的推送)
+func (d *Logger) RemoveWriter(w IWriter) bool {
+	root := d.root()
+	root.mutex.Lock()
+	defer root.mutex.Unlock()
+	olds := *root.routes.Load()
+	news := make([]*route, 0, len(olds))
+	for _, rr := range olds {
+		if rr.writer != w {
+			news = append(news, rr)
+		}
+	}
+	root.routes.Store(&news)
+	return len(news) < len(olds)
+}
+
+// 替换级别和基础输出, 已创建的子日志随之生效, AddWriter添加的输出保留, 返回被替换的输出
+func (d *Logger) reset(level int32, ws ...IWriter) (olds []*route) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	routes := make([]*route, 0, len(ws))
+	for _, w := range ws {
+		routes = append(routes, &route{writer: w})
+	}
+	for _, rr := range *d.routes.Load() {
+		if rr.added {
+			routes = append(routes, rr)
+		} else {
+			olds = append(olds, rr)
+		}
+	}
 	atomic.StoreInt32(&d.level, level)
+	d.routes.Store(&routes)
+	return
+}
+
+// 设置级别, 子日志设置的是根日志的级别
+func (d *Logger) SetLevel(level int32) {
+	atomic.StoreInt32(&d.root().level, level)
+}
+
+func (d *Logger) root() *Logger {
+	if d.parent != nil {
+		return d.parent
+	}
+	return d
+}
+
+func (d *Logger) enable(level int32) bool {
+	return atomic.LoadInt32(&d.root().level) <= level
+}
+
+// 创建子日志, 每条日志都带上kvs中的上下文字段(如玩家id、trace id)
+func (d *Logger) With(kvs ...any) *Logger {
+	fields := make([]Field, 0, len(d.fields)+len(kvs))
+	fields = append(fields, d.fields...)
+	return &Logger{parent: d.root(), fields: append(fields, toFields(kvs)...)}
 }
 
 func (d *Logger) Trace(skip int, format string, args ...any) {
-	if atomic.LoadInt32(&d.level) <= LOG_TRACE {
-		d.output(skip+1, LOG_TRACE, fmt.Sprintf(format, args...))
+	if d.enable(LOG_TRACE) {
+		d.output(skip+1, LOG_TRACE, fmt.Sprintf(format, args...), nil)
+	}
+}
+
+func (d *Logger) Tracew(skip int, msg string, kvs ...any) {
+	if d.enable(LOG_TRACE) {
+		d.output(skip+1, LOG_TRACE, msg, toFields(kvs))
 	}
 }
 
 func (d *Logger) Debug(skip int, format string, args ...any) {
-	if atomic.LoadInt32(&d.level) <= LOG_DEBUG {
-		d.output(skip+1, LOG_DEBUG, fmt.Sprintf(format, args...))
+	if d.enable(LOG_DEBUG) {
+		d.output(skip+1, LOG_DEBUG, fmt.Sprintf(format, args...), nil)
+	}
+}
+
+func (d *Logger) Debugw(skip int, msg string, kvs ...any) {
+	if d.enable(LOG_DEBUG) {
+		d.output(skip+1, LOG_DEBUG, msg, toFields(kvs))
 	}
 }
 
 func (d *Logger) Warn(skip int, format string, args ...any) {
-	if atomic.LoadInt32(&d.level) <= LOG_WARN {
-		d.output(skip+1, LOG_WARN, fmt.Sprintf(format, args...))
+	if d.enable(LOG_WARN) {
+		d.output(skip+1, LOG_WARN, fmt.Sprintf(format, args...), nil)
+	}
+}
+
+func (d *Logger) Warnw(skip int, msg string, kvs ...any) {
+	if d.enable(LOG_WARN) {
+		d.output(skip+1, LOG_WARN, msg, toFields(kvs))
 	}
 }
 
 func (d *Logger) Info(skip int, format string, args ...any) {
-	if atomic.LoadInt32(&d.level) <= LOG_INFO {
-		d.output(skip+1, LOG_INFO, fmt.Sprintf(format, args...))
+	if d.enable(LOG_INFO) {
+		d.output(skip+1, LOG_INFO, fmt.Sprintf(format, args...), nil)
+	}
+}
+
+func (d *Logger) Infow(skip int, msg string, kvs ...any) {
+	if d.enable(LOG_INFO) {
+		d.output(skip+1, LOG_INFO, msg, toFields(kvs))
 	}
 }
 
 func (d *Logger) Error(skip int, format string, args ...any) {
-	if atomic.LoadInt32(&d.level) <= LOG_ERROR {
-		d.output(skip+1, LOG_ERROR, fmt.Sprintf(format, args...))
+	if d.enable(LOG_ERROR) {
+		d.output(skip+1, LOG_ERROR, fmt.Sprintf(format, args...), nil)
+	}
+}
+
+func (d *Logger) Errorw(skip int, msg string, kvs ...any) {
+	if d.enable(LOG_ERROR) {
+		d.output(skip+1, LOG_ERROR, msg, toFields(kvs))
 	}
 }
 
 func (d *Logger) Fatal(skip int, format string, args ...any) {
-	if atomic.LoadInt32(&d.level) <= LOG_FATAL {
-		d.output(skip+1, LOG_FATAL, fmt.Sprintf(format, args...))
+	if d.enable(LOG_FATAL) {
+		d.output(skip+1, LOG_FATAL, fmt.Sprintf(format, args...), nil)
+	}
+}
+
+func (d *Logger) Fatalw(skip int, msg string, kvs ...any) {
+	if d.enable(LOG_FATAL) {
+		d.output(skip+1, LOG_FATAL, msg, toFields(kvs))
 	}
 }
 
-func (d *Logger) output(depth int, level int32, msg string) {
-	meta := Meta{Level: level, Msg: msg}
+func (d *Logger) output(depth int, level int32, msg string, fields []Field) {
+	meta := Meta{Level: level, Msg: msg, Fields: fields}
+	if len(d.fields) > 0 {
+		meta.Fields = append(d.fields[:len(d.fields):len(d.fields)], fields...)
+	}
 	if depth > 0 {
 		pc, file, line, _ := runtime.Caller(depth + 1)
 		fname := path.Base(runtime.FuncForPC(pc).Name())
@@ -86,10 +204,31 @@ func (d *Logger) output(depth int, level int32, msg string) {
 		meta.FileName = file
 		meta.Line = line
 		meta.FuncName = fname
+		meta.Package = getPackage(runtime.FuncForPC(pc).Name())
 	}
-	data := get(len(d.list))
+	// 先选出匹配的输出, 再按数量设置引用计数
+	var buf [8]*route
+	list := buf[:0]
+	for _, rr := range *d.root().routes.Load() {
+		if rr.match(&meta) {
+			list = append(list, rr)
+		}
+	}
+	if len(list) <= 0 {
+		return
+	}
+	data := get(len(list))
 	data.Write(meta)
-	for _, w := range d.list {
-		w.Push(data)
+	for _, rr := range list {
+		rr.writer.Push(data)
+	}
+}
+
+// 从函数全名中取包路径, 如github.com/hechh/library/mlog.(*Logger).output
+func getPackage(name string) string {
+	pos := strings.LastIndexByte(name, '/') + 1
+	if dot := strings.IndexByte(name[pos:], '.'); dot >= 0 {
+		return name[:pos+dot]
 	}
+	return name
 }
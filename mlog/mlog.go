@@ -24,8 +24,10 @@ type Meta struct {
 	FileName string
 	Line     int
 	FuncName string
+	Package  string // 包路径
 	Level    int32
 	Msg      string
+	Fields   []Field // 结构化字段, 包含With带入的上下文字段
 }
 
 type IData interface {
@@ -34,6 +36,7 @@ type IData interface {
 	Done() int32    // 完成次数
 	Write(Meta)     // 写入数据
 	Read() []byte   // 读取数据
+	GetMeta() *Meta // 原始数据
 }
 
 type IWriter interface {
@@ -53,15 +56,22 @@ func put(obj IData) {
 	}
 }
 
+// 初始化全局日志, 在原日志上替换输出, mlog.With创建的子日志同样生效
+// 只替换并关闭Init创建的输出, AddWriter添加的输出保留
 func Init(mode string, level string, lpath string, lname string) {
-	logObj.Close()
+	var ws []IWriter
 	switch mode {
 	case "debug":
-		logObj = NewLogger(level, &StdWriter{})
+		ws = append(ws, NewStdWriter().SetEncoder(NewConsoleEncoder(nil)))
 	case "develop":
-		logObj = NewLogger(level, &StdWriter{}, NewLogWriter(lpath, lname))
+		ws = append(ws, &StdWriter{}, NewLogWriter(lpath, lname))
 	case "release":
-		logObj = NewLogger(level, NewLogWriter(lpath, lname))
+		ws = append(ws, NewLogWriter(lpath, lname))
+	default:
+		return
+	}
+	for _, rr := range logObj.reset(StringToLevel(level), ws...) {
+		rr.writer.Close()
 	}
 }
 
@@ -69,6 +79,16 @@ func Close() {
 	logObj.Close()
 }
 
+// 添加输出, 只输出不低于level且满足所有过滤条件的日志, 重新Init后仍然保留
+func AddWriter(w IWriter, level int32, filters ...IFilter) {
+	logObj.AddWriter(w, level, filters...)
+}
+
+// 移除输出, 不会关闭w
+func RemoveWriter(w IWriter) bool {
+	return logObj.RemoveWriter(w)
+}
+
 func Tracef(format string, args ...any) {
 	logObj.Trace(1, format, args...)
 }
@@ -93,6 +113,35 @@ func Fatalf(format string, args ...any) {
 	logObj.Fatal(1, format, args...)
 }
 
+func Tracew(msg string, kvs ...any) {
+	logObj.Tracew(1, msg, kvs...)
+}
+
+func Debugw(msg string, kvs ...any) {
+	logObj.Debugw(1, msg, kvs...)
+}
+
+func Warnw(msg string, kvs ...any) {
+	logObj.Warnw(1, msg, kvs...)
+}
+
+func Infow(msg string, kvs ...any) {
+	logObj.Infow(1, msg, kvs...)
+}
+
+func Errorw(msg string, kvs ...any) {
+	logObj.Errorw(1, msg, kvs...)
+}
+
+func Fatalw(msg string, kvs ...any) {
+	logObj.Fatalw(1, msg, kvs...)
+}
+
+// 创建带上下文字段的子日志
+func With(kvs ...any) *Logger {
+	return logObj.With(kvs...)
+}
+
 func Trace(skip int, format string, args ...any) {
 	logObj.Trace(skip+1, format, args...)
 }
@@ -0,0 +1,360 @@
+package mlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 收集日志, 用于测试
+type testWriter struct {
+	mutex sync.Mutex
+	lines []string
+	metas []Meta
+}
+
+func (d *testWriter) Push(data IData) {
+	defer put(data)
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.lines = append(d.lines, string(data.Read()))
+	meta := *data.GetMeta()
+	meta.Fields = append([]Field(nil), meta.Fields...)
+	d.metas = append(d.metas, meta)
+}
+
+func (d *testWriter) Close() {}
+
+func TestInfow(t *testing.T) {
+	ww := &testWriter{}
+	ll := NewLogger(LOG_DEBUG, ww)
+	ll.Infow(0, "login", "uid", 123, "room", int32(7), String("name", "a b"), Err(errors.New("bad")), "cost", 1500*time.Millisecond, "odd")
+	if len(ww.lines) != 1 || !strings.HasSuffix(ww.lines[0], "\tlogin\tuid=123 room=7 name=\"a b\" error=bad cost=1.5s !BADKEY=odd\n") {
+		t.Fatalf("lines: %q", ww.lines)
+	}
+	fields := ww.metas[0].Fields
+	if len(fields) != 6 || fields[0].Type != FIELD_INT || fields[1].Value() != int64(7) || fields[3].Value() != "bad" {
+		t.Fatalf("fields: %+v", fields)
+	}
+	ll.Tracew(0, "ignored", "uid", 1)
+	if len(ww.lines) != 1 {
+		t.Fatal("expect trace ignored")
+	}
+}
+
+func TestWith(t *testing.T) {
+	ww := &testWriter{}
+	ll := NewLogger(LOG_DEBUG, ww)
+	player := ll.With("uid", 123)
+	trace := player.With(String("trace", "t1"))
+	trace.Info(0, "hello %d", 1)
+	player.Warnw(0, "warn", "hp", 0)
+	ll.Info(0, "root")
+	if len(ww.lines) != 3 ||
+		!strings.HasSuffix(ww.lines[0], "\thello 1\tuid=123 trace=t1\n") ||
+		!strings.HasSuffix(ww.lines[1], "\twarn\tuid=123 hp=0\n") ||
+		!strings.HasSuffix(ww.lines[2], "\troot\n") {
+		t.Fatalf("lines: %q", ww.lines)
+	}
+	if !strings.Contains(ww.lines[0], "mlog_test.go:") {
+		t.Fatalf("caller: %q", ww.lines[0])
+	}
+	// 子日志共享根日志的级别
+	ll.SetLevel(LOG_ERROR)
+	trace.Info(0, "ignored")
+	if len(ww.lines) != 3 {
+		t.Fatal("expect info ignored")
+	}
+}
+
+func TestInitWith(t *testing.T) {
+	defer logObj.reset(LOG_DEBUG, &StdWriter{})
+	dir := t.TempDir()
+	player := With("uid", 123)
+	errs := &testWriter{}
+	AddWriter(errs, LOG_ERROR)
+	defer RemoveWriter(errs)
+	Init("release", "info", dir, "game")
+	player.Info(0, "after init")
+	player.Debug(0, "ignored")
+	player.Error(0, "error")
+	Close()
+
+	// AddWriter添加的输出在Init后保留
+	if len(errs.lines) != 1 || !strings.HasSuffix(errs.lines[0], "\terror\tuid=123\n") {
+		t.Fatalf("errs: %q", errs.lines)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "game_*.log"))
+	if len(files) != 1 {
+		t.Fatalf("files: %v", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	if !strings.Contains(string(data), "\tafter init\tuid=123\n") {
+		t.Fatalf("data: %q", data)
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	tt := time.Date(2026, 10, 18, 10, 0, 0, 123e6, time.UTC)
+	meta := &Meta{
+		FileName: "/root/game/player.go",
+		Line:     42,
+		FuncName: "(*Player).Login",
+		Level:    LOG_INFO,
+		Msg:      "login \"ok\"",
+		Fields:   []Field{Int("uid", 123), String("room", "a b"), Bool("vip", true), Any("tags", []string{"x"})},
+	}
+	text := string(NewTextEncoder(nil).Encode(nil, tt, meta))
+	if text != "[2026-10-18 10:00:00.123]\t[INFO]\tplayer.go:42 (*Player).Login\tlogin \"ok\"\tuid=123 room=\"a b\" vip=true tags=[x]\n" {
+		t.Errorf("text: %q", text)
+	}
+	logfmt := string(NewLogfmtEncoder(&EncoderConfig{TimeFormat: time.RFC3339}).Encode(nil, tt, meta))
+	if logfmt != "time=2026-10-18T10:00:00Z level=INFO caller=player.go:42 func=(*Player).Login msg=\"login \\\"ok\\\"\" uid=123 room=\"a b\" vip=true tags=[x]\n" {
+		t.Errorf("logfmt: %q", logfmt)
+	}
+	console := string(NewConsoleEncoder(nil).Encode(nil, tt, meta))
+	if !strings.Contains(console, levelColors[LOG_INFO]+"INFO"+colorReset) || strings.Count(console, "2026") != 1 {
+		t.Errorf("console: %q", console)
+	}
+
+	data := NewJSONEncoder(&EncoderConfig{TimeKey: "@timestamp", MsgKey: "message"}).Encode(nil, tt, meta)
+	rets := map[string]any{}
+	if err := json.Unmarshal(data, &rets); err != nil {
+		t.Fatalf("json: %s, %v", data, err)
+	}
+	if rets["@timestamp"] != "2026-10-18 10:00:00.123" || rets["message"] != "login \"ok\"" || rets["caller"] != "player.go:42" ||
+		rets["uid"] != float64(123) || rets["vip"] != true || fmt.Sprint(rets["tags"]) != "[x]" {
+		t.Errorf("json: %s", data)
+	}
+	if ss := string(appendJSONString(nil, "a\x01\n\xff")); ss != `"a\u0001\n�"` {
+		t.Errorf("json string: %s", ss)
+	}
+}
+
+func TestDataLazy(t *testing.T) {
+	data := NewData().(*Data)
+	data.Write(Meta{Level: LOG_INFO, Msg: "lazy"})
+	if data.encoded || len(data.buffer) > 0 {
+		t.Fatal("expect not encoded before Read")
+	}
+	if line := string(data.Read()); !strings.HasSuffix(line, "\tlazy\n") || !data.encoded {
+		t.Fatalf("line: %q", line)
+	}
+	data.Write(Meta{Level: LOG_INFO, Msg: "next"})
+	if line := string(data.Read()); !strings.HasSuffix(line, "\tnext\n") {
+		t.Fatalf("line: %q", line)
+	}
+}
+
+func TestStdWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ww := &StdWriter{out: buf}
+	ll := NewLogger(LOG_DEBUG, ww)
+	ll.Info(0, "hello")
+	// 只有一个时间戳
+	if line := buf.String(); !strings.HasPrefix(line, "[") || strings.Count(line, time.Now().Format("2006-01-02")) != 1 {
+		t.Fatalf("line: %q", line)
+	}
+	buf.Reset()
+	ww.SetEncoder(NewJSONEncoder(nil))
+	ll.Infow(0, "hello", "uid", 1)
+	if !json.Valid(buf.Bytes()) || !strings.Contains(buf.String(), `"msg":"hello","uid":1}`) {
+		t.Fatalf("line: %q", buf.String())
+	}
+	// 设置编码器后不再生成默认文本
+	data := NewData().(*Data)
+	data.Add(2)
+	data.Write(Meta{Level: LOG_INFO, Msg: "lazy"})
+	ww.Push(data)
+	if data.encoded {
+		t.Fatal("expect not encoded")
+	}
+}
+
+func TestRotate(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "game_20200101.log")
+	os.WriteFile(old, []byte("old\n"), 0644)
+	os.Chtimes(old, time.Now().Add(-240*time.Hour), time.Now().Add(-240*time.Hour))
+
+	ww := NewRotateWriter(dir, "game", RotateConfig{MaxSize: 1000, MaxFiles: 3, MaxAge: 24 * time.Hour, Compress: true, Symlink: "game.log"})
+	ll := NewLogger(LOG_DEBUG, ww)
+	for i := 0; i < 50; i++ {
+		ll.Infow(0, strings.Repeat("x", 50), "seq", i)
+	}
+	ll.Close()
+
+	period := ww.getPeriod(time.Now())
+	current, err := os.Readlink(filepath.Join(dir, "game.log"))
+	if err != nil || current != filepath.Base(ww.getFileName(period, ww.seq)) || ww.seq < 5 {
+		t.Fatalf("symlink: %s, seq: %d, %v", current, ww.seq, err)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Fatal("expect expired file removed")
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "game_*.log.gz"))
+	if len(files) != 3 {
+		t.Fatalf("history: %v", files)
+	}
+	for _, file := range files {
+		fp, _ := os.Open(file)
+		zr, err := gzip.NewReader(fp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(zr)
+		fp.Close()
+		if err != nil || len(data) < 1000 || data[len(data)-1] != '\n' {
+			t.Fatalf("gzip: %s, %d, %v", file, len(data), err)
+		}
+	}
+
+	// 重启后继续写最后一段
+	if seq := ww.getMaxSeq(period); seq != ww.seq {
+		t.Fatalf("max seq: %d, expect: %d", seq, ww.seq)
+	}
+	hourly := &LogWriter{lpath: "logs", lname: "game", rotate: RotateConfig{Mode: ROTATE_HOURLY}}
+	tt := time.Date(2026, 10, 18, 9, 30, 0, 0, time.Local)
+	if name := hourly.getFileName(hourly.getPeriod(tt), 2); name != "logs/game_2026101809.2.log" {
+		t.Fatalf("hourly: %s", name)
+	}
+}
+
+func TestRoute(t *testing.T) {
+	all, errs, room := &testWriter{}, &testWriter{}, &testWriter{}
+	ll := NewLogger(LOG_DEBUG, all)
+	ll.AddWriter(errs, LOG_ERROR)
+	ll.AddWriter(room, LOG_DEBUG, PackageFilter("github.com/hechh/library/mlog"), FieldFilter("room", 7, 8))
+	ll.Debugw(0, "a", "room", 7)
+	ll.Errorw(0, "b", "room", 9)
+	ll.With("room", 8).Error(0, "c")
+	if len(all.lines) != 3 || len(errs.lines) != 2 || len(room.lines) != 2 {
+		t.Fatalf("all: %d, errs: %d, room: %d", len(all.lines), len(errs.lines), len(room.lines))
+	}
+	if meta := room.metas[1]; meta.Msg != "c" || meta.Package != "github.com/hechh/library/mlog" {
+		t.Fatalf("meta: %+v", meta)
+	}
+
+	if !ll.RemoveWriter(all) || ll.RemoveWriter(all) {
+		t.Fatal("remove writer failed")
+	}
+	ll.AddWriter(all, LOG_DEBUG, NotFilter(FileFilter("/not/exist")))
+	ll.Info(0, "d")
+	if len(all.lines) != 4 || len(errs.lines) != 2 {
+		t.Fatalf("all: %d, errs: %d", len(all.lines), len(errs.lines))
+	}
+
+	// 并发添加移除
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				ww := &testWriter{}
+				ll.AddWriter(ww, LOG_DEBUG)
+				ll.RemoveWriter(ww)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				ll.Infow(0, "e", "j", j)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(all.lines) != 404 {
+		t.Fatalf("all: %d", len(all.lines))
+	}
+}
+
+func TestRotateSibling(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-240 * time.Hour)
+	files := []string{"game_20200101.log", "game_1_20200101.log", "game_1_20200101.2.log.gz", "game_2020010100.log", "game_x.log"}
+	for _, name := range files {
+		file := filepath.Join(dir, name)
+		os.WriteFile(file, []byte("old\n"), 0644)
+		os.Chtimes(file, old, old)
+	}
+	ww := NewRotateWriter(dir, "game", RotateConfig{MaxAge: time.Hour})
+	ll := NewLogger(LOG_DEBUG, ww)
+	ll.Info(0, "hello")
+	ll.Close()
+
+	// 只清理自己的历史文件
+	for i, name := range files {
+		if _, err := os.Stat(filepath.Join(dir, name)); (i == 0) != os.IsNotExist(err) {
+			t.Fatalf("file: %s, %v", name, err)
+		}
+	}
+}
+
+func TestRotateLate(t *testing.T) {
+	dir := t.TempDir()
+	ww := NewRotateWriter(dir, "g", RotateConfig{Mode: ROTATE_HOURLY, Compress: true})
+	push := func(tt time.Time, msg string) {
+		data := get(1)
+		data.Write(Meta{Level: LOG_INFO, Msg: msg})
+		data.(*Data).time = tt
+		ww.Push(data)
+	}
+	h10 := time.Date(2026, 10, 18, 10, 59, 59, 999e6, time.Local)
+	h11 := time.Date(2026, 10, 18, 11, 0, 0, 0, time.Local)
+	for i := 0; i < 100; i++ {
+		push(h10, "h10")
+	}
+	// 迟到的日志写入当前文件, 不切回上个周期
+	push(h11, "h11")
+	push(h10, "h10-late")
+	push(h11, "h11")
+	ww.Close()
+
+	readGzip := func(file string) string {
+		fp, err := os.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fp.Close()
+		zr, err := gzip.NewReader(fp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(zr)
+		return string(data)
+	}
+	if data := readGzip(filepath.Join(dir, "g_2026101810.log.gz")); strings.Count(data, "\th10\n") != 100 || strings.Contains(data, "late") {
+		t.Fatalf("h10: %d lines", strings.Count(data, "\n"))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "g_2026101811.log.gz")); !os.IsNotExist(err) {
+		t.Fatal("current file compressed")
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "g_2026101811.log"))
+	if strings.Count(string(data), "\n") != 3 || !strings.Contains(string(data), "\th10-late\n") {
+		t.Fatalf("h11: %q", data)
+	}
+
+	// 已有归档时追加新的gzip成员
+	file := filepath.Join(dir, "g_2026101811.log")
+	if err := compressFile(file); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(file, []byte("more\n"), 0644)
+	if err := compressFile(file); err != nil {
+		t.Fatal(err)
+	}
+	if data := readGzip(file + ".gz"); strings.Count(data, "\n") != 4 || !strings.HasSuffix(data, "more\n") {
+		t.Fatalf("append: %q", data)
+	}
+}
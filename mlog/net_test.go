@@ -0,0 +1,188 @@
+package mlog
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 从流式连接中读取行
+func readLines(t *testing.T, ln net.Listener, count int) []string {
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	rr := bufio.NewReader(conn)
+	rets := []string{}
+	for len(rets) < count {
+		line, err := rr.ReadString('\n')
+		if err != nil {
+			t.Fatal(err, rets)
+		}
+		rets = append(rets, line)
+	}
+	return rets
+}
+
+func TestNetWriterTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ww := NewNetWriter("tcp", addr, 100).SetEncoder(NewLogfmtEncoder(nil))
+	ll := NewLogger(LOG_DEBUG, ww)
+	defer ll.Close()
+	for i := 0; i < 10; i++ {
+		ll.Infow(0, "hello", "seq", i)
+	}
+	lines := readLines(t, ln, 10)
+	if !strings.Contains(lines[9], "msg=hello seq=9\n") {
+		t.Fatalf("lines: %q", lines)
+	}
+	ln.Close()
+
+	// 服务端重启后重连
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			case <-time.After(20 * time.Millisecond):
+				ll.Infow(0, "retry", "seq", i)
+			}
+		}
+	}()
+	lines = readLines(t, ln, 1)
+	done <- struct{}{}
+	<-done
+	if !strings.Contains(lines[0], "msg=retry") {
+		t.Fatalf("lines: %q", lines)
+	}
+}
+
+func TestNetWriterUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	ww := NewNetWriter("udp", pc.LocalAddr().String(), 100)
+	ll := NewLogger(LOG_DEBUG, ww)
+	ll.Info(0, "hello udp")
+	ll.Close()
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1024)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil || !strings.HasSuffix(string(buf[:n]), "\thello udp\n") {
+		t.Fatalf("read: %q, %v", buf[:n], err)
+	}
+}
+
+func TestNetWriterDrop(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := ln.Addr().String()
+	ln.Close()
+	// 连接不上时缓冲满后丢弃, 关闭不阻塞
+	ww := NewNetWriter("tcp", addr, 2)
+	ll := NewLogger(LOG_DEBUG, ww)
+	for i := 0; i < 10; i++ {
+		ll.Info(0, "drop")
+	}
+	start := time.Now()
+	ll.Close()
+	ll.Info(0, "after close")
+	if ww.GetDropped() != 11 || time.Since(start) > time.Second {
+		t.Fatalf("dropped: %d, cost: %v", ww.GetDropped(), time.Since(start))
+	}
+}
+
+var syslogRegexp = regexp.MustCompile(`^<134>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}\S+ \S+ game \d+ - \[log@32473 caller="net_test.go:\d+" func="\S+" uid="1" name="a\\"b\\]"\] hello$`)
+
+func TestSyslogWriter(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	ll := NewLogger(LOG_DEBUG, NewSyslogWriter("udp", pc.LocalAddr().String(), SYSLOG_LOCAL0, "game", 100))
+	ll.Infow(0, "hello", "uid", 1, "name", `a"b]`)
+	ll.Close()
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1024)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil || !syslogRegexp.Match(buf[:n]) {
+		t.Fatalf("udp: %q, %v", buf[:n], err)
+	}
+
+	// unix流式连接使用长度前缀分帧
+	sock := filepath.Join(t.TempDir(), "syslog.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	ll = NewLogger(LOG_DEBUG, NewSyslogWriter("unix", sock, SYSLOG_LOCAL0, "game", 100))
+	ll.Infow(0, "hello", "uid", 1, "name", `a"b]`)
+	ll.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	data, _ := io.ReadAll(conn)
+	size, msg, _ := strings.Cut(string(data), " ")
+	if size != strconv.Itoa(len(msg)) || !syslogRegexp.MatchString(msg) {
+		t.Fatalf("unix: %q", data)
+	}
+}
+
+func TestHTTPWriter(t *testing.T) {
+	mutex := sync.Mutex{}
+	bodies := []string{}
+	var fails int32 = 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 第一次请求失败, 验证重试
+		if atomic.AddInt32(&fails, -1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		bodies = append(bodies, string(data))
+		mutex.Unlock()
+	}))
+	defer srv.Close()
+
+	ww := NewHTTPWriter(srv.URL, 5, 50*time.Millisecond, 100)
+	ll := NewLogger(LOG_DEBUG, ww)
+	for i := 0; i < 12; i++ {
+		ll.Infow(0, "hello", "seq", i)
+	}
+	ll.Close()
+	mutex.Lock()
+	defer mutex.Unlock()
+	lines := strings.Split(strings.TrimSpace(strings.Join(bodies, "")), "\n")
+	if len(bodies) < 3 || len(lines) != 12 || !strings.HasSuffix(lines[11], `"msg":"hello","seq":11}`) || ww.GetDropped() != 0 {
+		t.Fatalf("bodies: %d, lines: %q, dropped: %d", len(bodies), lines, ww.GetDropped())
+	}
+}
@@ -0,0 +1,167 @@
+package mlog
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	dialTimeout  = 3 * time.Second
+	writeTimeout = 5 * time.Second
+	minBackoff   = 100 * time.Millisecond
+	maxBackoff   = 5 * time.Second
+)
+
+// 网络日志输出, 后台协程发送, 断线自动重连
+// 缓冲满或关闭时丢弃新日志, 不阻塞调用方
+type NetWriter struct {
+	sync.WaitGroup
+	network string // tcp, udp, unix, unixgram
+	addr    string
+	stream  bool                       // 流式连接
+	octet   bool                       // 流式连接使用长度前缀分帧(RFC6587)
+	format  func([]byte, IData) []byte // 编码一条日志
+	encoder IEncoder                   // nil表示默认文本格式
+	conn    net.Conn
+	buffer  []byte
+	frame   []byte
+	datas   chan IData
+	exit    chan struct{}
+	status  int32  // 1表示已关闭
+	dropped uint64 // 丢弃的日志数
+}
+
+// 按行发送日志, size为缓冲的日志条数
+// 流式连接(tcp, unix)每条日志以换行结尾, 数据报连接(udp, unixgram)每条日志一个数据报
+func NewNetWriter(network, addr string, size int) *NetWriter {
+	ret := newNetWriter(network, addr, size)
+	ret.format = ret.formatLine
+	ret.Add(1)
+	go ret.run()
+	return ret
+}
+
+func newNetWriter(network, addr string, size int) *NetWriter {
+	stream := network == "tcp" || network == "tcp4" || network == "tcp6" || network == "unix"
+	return &NetWriter{
+		network: network,
+		addr:    addr,
+		stream:  stream,
+		datas:   make(chan IData, max(size, 1)),
+		exit:    make(chan struct{}),
+	}
+}
+
+// 设置编码器, 需在Push之前调用
+func (d *NetWriter) SetEncoder(enc IEncoder) *NetWriter {
+	d.encoder = enc
+	return d
+}
+
+// 丢弃的日志数
+func (d *NetWriter) GetDropped() uint64 {
+	return atomic.LoadUint64(&d.dropped)
+}
+
+func (d *NetWriter) Push(data IData) {
+	if atomic.LoadInt32(&d.status) > 0 {
+		atomic.AddUint64(&d.dropped, 1)
+		put(data)
+		return
+	}
+	select {
+	case d.datas <- data:
+	default:
+		atomic.AddUint64(&d.dropped, 1)
+		put(data)
+	}
+}
+
+// 关闭并尽量发送缓冲中的日志
+func (d *NetWriter) Close() {
+	if atomic.CompareAndSwapInt32(&d.status, 0, 1) {
+		close(d.exit)
+	}
+	d.Wait()
+}
+
+func (d *NetWriter) formatLine(buf []byte, data IData) []byte {
+	if d.encoder != nil {
+		return d.encoder.Encode(buf, data.Now(), data.GetMeta())
+	}
+	return append(buf, data.Read()...)
+}
+
+func (d *NetWriter) run() {
+	defer func() {
+		if d.conn != nil {
+			d.conn.Close()
+		}
+		d.Done()
+	}()
+	for {
+		select {
+		case data := <-d.datas:
+			d.buffer = d.format(d.buffer[:0], data)
+			put(data)
+			d.send(true)
+		case <-d.exit:
+			// 关闭时只尝试一次, 不再等待重连
+			for {
+				select {
+				case data := <-d.datas:
+					d.buffer = d.format(d.buffer[:0], data)
+					put(data)
+					d.send(false)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// 发送buffer中的一条日志, retry为true时失败后退避重连直到成功或关闭
+func (d *NetWriter) send(retry bool) {
+	msg := d.buffer
+	if d.stream && d.octet {
+		d.frame = strconv.AppendInt(d.frame[:0], int64(len(msg)), 10)
+		d.frame = append(d.frame, ' ')
+		msg = append(d.frame, msg...)
+		d.frame = msg
+	}
+	for backoff := minBackoff; ; backoff = min(backoff*2, maxBackoff) {
+		if d.write(msg) == nil {
+			return
+		}
+		if !retry {
+			break
+		}
+		select {
+		case <-time.After(backoff):
+		case <-d.exit:
+			retry = false
+		}
+	}
+	atomic.AddUint64(&d.dropped, 1)
+}
+
+func (d *NetWriter) write(msg []byte) error {
+	if d.conn == nil {
+		conn, err := net.DialTimeout(d.network, d.addr, dialTimeout)
+		if err != nil {
+			return err
+		}
+		d.conn = conn
+	}
+	d.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := d.conn.Write(msg); err != nil {
+		d.conn.Close()
+		d.conn = nil
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package mlog
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hechh/library/util"
+)
+
+// 切分周期
+const (
+	ROTATE_DAILY  = 0 // 按天: name_20261018.log
+	ROTATE_HOURLY = 1 // 按小时: name_2026101810.log
+)
+
+// 日志切分配置, 零值表示按天切分且不清理
+type RotateConfig struct {
+	Mode     int32         // 切分周期
+	MaxSize  int64         // 单个文件最大字节数, 超出后切分为编号段(name_20261018.1.log), 0不限制
+	MaxFiles int           // 最多保留的历史文件数(不含当前文件), 0不限制
+	MaxAge   time.Duration // 历史文件最长保留时间, 0不限制
+	Compress bool          // 后台gzip压缩切换下来的文件
+	Symlink  string        // lpath下指向当前文件的软链接名, 空表示不创建
+}
+
+func (d *LogWriter) getPeriod(tt time.Time) string {
+	if d.rotate.Mode == ROTATE_HOURLY {
+		return fmt.Sprintf("%04d%02d%02d%02d", tt.Year(), tt.Month(), tt.Day(), tt.Hour())
+	}
+	return fmt.Sprintf("%04d%02d%02d", tt.Year(), tt.Month(), tt.Day())
+}
+
+func (d *LogWriter) getFileName(period string, seq int) string {
+	if seq <= 0 {
+		return path.Join(d.lpath, fmt.Sprintf("%s_%s.log", d.lname, period))
+	}
+	return path.Join(d.lpath, fmt.Sprintf("%s_%s.%d.log", d.lname, period, seq))
+}
+
+// 已存在的最大分段编号, 重启后继续写最后一段
+func (d *LogWriter) getMaxSeq(period string) (ret int) {
+	files, _ := filepath.Glob(path.Join(d.lpath, fmt.Sprintf("%s_%s.*", d.lname, period)))
+	for _, file := range files {
+		if pp, seq, ok := d.parseFileName(file); ok && pp == period {
+			ret = max(ret, seq)
+		}
+	}
+	return
+}
+
+// 按日志时间和文件大小切换文件, 切换下来的文件交给后台压缩和清理
+// 日志时间在生产者协程中生成, 入队顺序可能与时间顺序不一致, 所以只向后切换周期, 迟到的日志写入当前文件
+func (d *LogWriter) switchFile(m IData) {
+	if period := d.getPeriod(m.Now()); period > d.period {
+		d.period = period
+		d.seq = d.getMaxSeq(period)
+	}
+	filename := d.getFileName(d.period, d.seq)
+	if d.rotate.MaxSize > 0 && d.cache.Name() == filename && d.cache.Size() >= d.rotate.MaxSize {
+		d.seq++
+		filename = d.getFileName(d.period, d.seq)
+	}
+
+	old := d.cache.Name()
+	if err := d.cache.Set(filename); err != nil {
+		return
+	}
+	if old == filename {
+		return
+	}
+	d.opened.Store(&filename)
+	if len(d.rotate.Symlink) > 0 && d.link != filename {
+		d.link = filename
+		d.symlink(filename)
+	}
+	// 首次打开时也清理一次过期文件
+	if d.rotate.Compress || d.rotate.MaxFiles > 0 || d.rotate.MaxAge > 0 {
+		d.archive.Push(func() { d.archiveFile(old, filename) })
+	}
+}
+
+// 原子替换软链接
+func (d *LogWriter) symlink(filename string) {
+	link := path.Join(d.lpath, d.rotate.Symlink)
+	tmp := link + ".tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(filepath.Base(filename), tmp); err != nil {
+		return
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+	}
+}
+
+// 在后台协程执行: 压缩old, 然后按数量和时间清理历史文件, current为当前文件
+func (d *LogWriter) archiveFile(old, current string) {
+	// 不压缩正在写入的文件
+	if len(old) > 0 && old != current && old != *d.opened.Load() && d.rotate.Compress {
+		// 已被清理的文件不再压缩
+		if err := compressFile(old); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "mlog compress %s failed: %v\n", old, err)
+		}
+	}
+	if d.rotate.MaxFiles <= 0 && d.rotate.MaxAge <= 0 {
+		return
+	}
+
+	type history struct {
+		name    string
+		period  string
+		seq     int
+		modTime time.Time
+	}
+	// 当前文件及之后切换的文件都不是历史文件
+	curPeriod, curSeq, _ := d.parseFileName(current)
+	files, _ := filepath.Glob(path.Join(d.lpath, d.lname+"_*"))
+	list := []history{}
+	for _, file := range files {
+		period, seq, ok := d.parseFileName(file)
+		if !ok || period > curPeriod || (period == curPeriod && seq >= curSeq) {
+			continue
+		}
+		// 跳过软链接和目录
+		if st, err := os.Lstat(file); err == nil && st.Mode().IsRegular() {
+			list = append(list, history{file, period, seq, st.ModTime()})
+		}
+	}
+	// 按周期和分段编号从新到旧排序
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].period != list[j].period {
+			return list[i].period > list[j].period
+		}
+		return list[i].seq > list[j].seq
+	})
+	now := time.Now()
+	for i, item := range list {
+		if (d.rotate.MaxFiles > 0 && i >= d.rotate.MaxFiles) || (d.rotate.MaxAge > 0 && now.Sub(item.modTime) > d.rotate.MaxAge) {
+			os.Remove(item.name)
+		}
+	}
+}
+
+// 解析name_周期[.编号].log[.gz]
+func (d *LogWriter) parseFileName(file string) (period string, seq int, ok bool) {
+	name := filepath.Base(file)
+	if !strings.HasPrefix(name, d.lname+"_") {
+		return
+	}
+	name = strings.TrimSuffix(name, ".gz")
+	if !strings.HasSuffix(name, ".log") {
+		return
+	}
+	name = strings.TrimSuffix(strings.TrimPrefix(name, d.lname+"_"), ".log")
+	period, str, found := strings.Cut(name, ".")
+	if found {
+		var err error
+		if seq, err = strconv.Atoi(str); err != nil || seq < 0 {
+			return
+		}
+	}
+	// 周期必须与切分模式一致(按天8位, 按小时10位数字), 避免误删同目录下其他日志的文件
+	if len(period) != util.Or(d.rotate.Mode == ROTATE_HOURLY, 10, 8) {
+		return
+	}
+	for _, ch := range period {
+		if ch < '0' || ch > '9' {
+			return
+		}
+	}
+	return period, seq, true
+}
+
+// 压缩为filename.gz并删除原文件, 保留原文件的修改时间
+// filename.gz已存在时追加一个新的gzip成员, 不覆盖已有的归档
+func compressFile(filename string) error {
+	src, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	st, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := util.CreateFile(filename+".gz", os.O_CREATE|os.O_APPEND|os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+	var size int64
+	if st, err := dst.Stat(); err == nil {
+		size = st.Size()
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		// 回退到追加前的内容
+		if size > 0 {
+			os.Truncate(filename+".gz", size)
+		} else {
+			os.Remove(filename + ".gz")
+		}
+		return err
+	}
+	os.Chtimes(filename+".gz", st.ModTime(), st.ModTime())
+	return os.Remove(filename)
+}
@@ -0,0 +1,92 @@
+package mlog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 日志过滤条件
+type IFilter interface {
+	Match(*Meta) bool
+}
+
+type FilterFunc func(*Meta) bool
+
+func (f FilterFunc) Match(meta *Meta) bool {
+	return f(meta)
+}
+
+// 包路径前缀匹配, 如github.com/hechh/library/async
+func PackageFilter(prefixes ...string) IFilter {
+	return FilterFunc(func(meta *Meta) bool {
+		return hasPrefix(meta.Package, prefixes)
+	})
+}
+
+// 文件路径前缀匹配
+func FileFilter(prefixes ...string) IFilter {
+	return FilterFunc(func(meta *Meta) bool {
+		return hasPrefix(meta.FileName, prefixes)
+	})
+}
+
+// 包含字段key, values不为空时字段值还需等于其中之一(按文本比较)
+func FieldFilter(key string, values ...any) IFilter {
+	strs := make([]string, len(values))
+	for i, val := range values {
+		strs[i] = fmt.Sprint(val)
+	}
+	return FilterFunc(func(meta *Meta) bool {
+		for _, ff := range meta.Fields {
+			if ff.Key != key {
+				continue
+			}
+			if len(strs) <= 0 {
+				return true
+			}
+			val := fmt.Sprint(ff.Value())
+			for _, str := range strs {
+				if str == val {
+					return true
+				}
+			}
+		}
+		return false
+	})
+}
+
+// 取反
+func NotFilter(f IFilter) IFilter {
+	return FilterFunc(func(meta *Meta) bool {
+		return !f.Match(meta)
+	})
+}
+
+func hasPrefix(str string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(str, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// 输出路由, 满足最低级别和所有过滤条件的日志才推送给writer
+type route struct {
+	writer  IWriter
+	level   int32
+	filters []IFilter
+	added   bool // 通过AddWriter添加, reset时保留
+}
+
+func (d *route) match(meta *Meta) bool {
+	if meta.Level < d.level {
+		return false
+	}
+	for _, f := range d.filters {
+		if !f.Match(meta) {
+			return false
+		}
+	}
+	return true
+}
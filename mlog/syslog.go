@@ -0,0 +1,138 @@
+package mlog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// syslog设施
+const (
+	SYSLOG_USER   = 1
+	SYSLOG_DAEMON = 3
+	SYSLOG_LOCAL0 = 16
+	SYSLOG_LOCAL7 = 23
+)
+
+// 结构化数据的SD-ID, 32473为文档示例保留的企业编号
+const syslogSDID = "log@32473"
+
+// 按RFC5424格式发送到syslog, network支持udp、tcp、unix和unixgram
+// 流式连接使用RFC6587长度前缀分帧, tag为APP-NAME
+func NewSyslogWriter(network, addr string, facility int, tag string, size int) *NetWriter {
+	ret := newNetWriter(network, addr, size)
+	ret.octet = true
+	hostname, _ := os.Hostname()
+	header := syslogHeader{
+		facility: facility,
+		hostname: syslogName(hostname, 255),
+		tag:      syslogName(tag, 48),
+		pid:      strconv.Itoa(os.Getpid()),
+	}
+	ret.format = header.format
+	ret.Add(1)
+	go ret.run()
+	return ret
+}
+
+type syslogHeader struct {
+	facility int
+	hostname string
+	tag      string
+	pid      string
+}
+
+func syslogSeverity(level int32) int {
+	switch level {
+	case LOG_TRACE, LOG_DEBUG:
+		return 7
+	case LOG_INFO:
+		return 6
+	case LOG_WARN:
+		return 4
+	case LOG_ERROR:
+		return 3
+	case LOG_FATAL:
+		return 2
+	}
+	return 5
+}
+
+// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD] MSG
+func (d *syslogHeader) format(buf []byte, data IData) []byte {
+	meta := data.GetMeta()
+	buf = append(buf, '<')
+	buf = strconv.AppendInt(buf, int64(d.facility*8+syslogSeverity(meta.Level)), 10)
+	buf = append(buf, ">1 "...)
+	buf = data.Now().AppendFormat(buf, "2006-01-02T15:04:05.000000Z07:00")
+	buf = append(buf, ' ')
+	buf = append(buf, d.hostname...)
+	buf = append(buf, ' ')
+	buf = append(buf, d.tag...)
+	buf = append(buf, ' ')
+	buf = append(buf, d.pid...)
+	buf = append(buf, " - "...)
+	if len(meta.FileName) <= 0 && len(meta.Fields) <= 0 {
+		buf = append(buf, '-')
+	} else {
+		buf = append(buf, '[')
+		buf = append(buf, syslogSDID...)
+		if len(meta.FileName) > 0 {
+			buf = append(buf, ` caller="`...)
+			buf = appendSDValue(buf, filepath.Base(meta.FileName)+":"+strconv.Itoa(meta.Line))
+			buf = append(buf, `" func="`...)
+			buf = appendSDValue(buf, meta.FuncName)
+			buf = append(buf, '"')
+		}
+		for _, ff := range meta.Fields {
+			buf = append(buf, ' ')
+			buf = append(buf, syslogName(ff.Key, 32)...)
+			buf = append(buf, `="`...)
+			buf = appendSDValue(buf, sdText(ff))
+			buf = append(buf, '"')
+		}
+		buf = append(buf, ']')
+	}
+	buf = append(buf, ' ')
+	return append(buf, meta.Msg...)
+}
+
+// 头部字段和SD参数名只能是可打印ASCII, 不能为空
+func syslogName(str string, size int) string {
+	if len(str) <= 0 {
+		return "-"
+	}
+	buf := []byte(str)
+	for i, cc := range buf {
+		if cc <= 32 || cc >= 127 || cc == '=' || cc == ']' || cc == '"' {
+			buf[i] = '_'
+		}
+	}
+	return string(buf[:min(len(buf), size)])
+}
+
+// 字段的原始文本, 由SD转义代替文本格式的引号
+func sdText(ff Field) string {
+	switch ff.Type {
+	case FIELD_STRING:
+		return ff.Str
+	case FIELD_ERROR:
+		return ff.Any.(error).Error()
+	case FIELD_ANY:
+		return fmt.Sprint(ff.Any)
+	}
+	var tmp [64]byte
+	return string(ff.AppendText(tmp[:0]))
+}
+
+// SD参数值需转义", \和]
+func appendSDValue(buf []byte, str string) []byte {
+	for i := 0; i < len(str); i++ {
+		if cc := str[i]; cc == '"' || cc == '\\' || cc == ']' {
+			buf = append(buf, '\\')
+		}
+		buf = append(buf, str[i])
+	}
+	return buf
+}
@@ -1,53 +1,101 @@
 package mlog
 
 import (
-	"fmt"
+	"io"
 	"os"
-	"path"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hechh/library/async"
 )
 
-type StdWriter struct{}
+type StdWriter struct {
+	mutex   sync.Mutex
+	out     io.Writer // nil表示标准输出
+	encoder IEncoder  // nil表示默认文本格式
+	buffer  []byte
+}
 
 func NewStdWriter() *StdWriter {
 	return &StdWriter{}
 }
 
+// 设置编码器, 需在Push之前调用
+func (d *StdWriter) SetEncoder(enc IEncoder) *StdWriter {
+	d.encoder = enc
+	return d
+}
+
 func (d *StdWriter) Push(data IData) {
 	defer put(data)
-	tt := data.Now()
-	fmt.Fprint(os.Stdout, tt.Format("2006-01-02 15:04:05")+"\t"+string(data.Read()))
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	var buf []byte
+	if d.encoder != nil {
+		d.buffer = d.encoder.Encode(d.buffer[:0], data.Now(), data.GetMeta())
+		buf = d.buffer
+	} else {
+		buf = data.Read()
+	}
+	if d.out != nil {
+		d.out.Write(buf)
+	} else {
+		os.Stdout.Write(buf)
+	}
 }
 
 func (d *StdWriter) Close() {}
 
 type LogWriter struct {
 	sync.WaitGroup
-	lpath  string
-	lname  string
-	cache  *Cache
-	datas  *async.Queue[IData]
-	notify chan struct{}
-	exit   chan struct{}
+	lpath   string
+	lname   string
+	rotate  RotateConfig
+	period  string                 // 当前周期, 如20261018
+	seq     int                    // 当前周期内的分段编号
+	link    string                 // 软链接当前指向的文件
+	opened  atomic.Pointer[string] // 当前打开的文件, 后台压缩时跳过
+	archive *async.Async           // 后台压缩和清理历史文件
+	cache   *Cache
+	encoder IEncoder // nil表示默认文本格式
+	encoded []byte
+	datas   *async.Queue[IData]
+	buffer  []IData
+	notify  chan struct{}
+	exit    chan struct{}
 }
 
+// 按天切分, 不清理历史文件
 func NewLogWriter(lpath, lname string) *LogWriter {
+	return NewRotateWriter(lpath, lname, RotateConfig{})
+}
+
+// 按配置切分、清理和压缩日志文件
+func NewRotateWriter(lpath, lname string, cfg RotateConfig) *LogWriter {
 	ret := &LogWriter{
-		lpath:  lpath,
-		lname:  lname,
-		cache:  NewCache(1024 * 1024),
-		datas:  async.NewQueue[IData](),
-		notify: make(chan struct{}, 1),
-		exit:   make(chan struct{}),
+		lpath:   lpath,
+		lname:   lname,
+		rotate:  cfg,
+		archive: async.NewAsync(),
+		cache:   NewCache(1024 * 1024),
+		datas:   async.NewQueue[IData](),
+		notify:  make(chan struct{}, 1),
+		exit:    make(chan struct{}),
 	}
+	ret.opened.Store(new(string))
+	ret.archive.Start()
 	ret.Add(1)
 	go ret.run()
 	return ret
 }
 
+// 设置编码器, 需在Push之前调用
+func (d *LogWriter) SetEncoder(enc IEncoder) *LogWriter {
+	d.encoder = enc
+	return d
+}
+
 func (d *LogWriter) Push(data IData) {
 	d.datas.Push(data)
 	select {
@@ -56,20 +104,19 @@ func (d *LogWriter) Push(data IData) {
 	}
 }
 
+// 关闭并等待后台压缩和清理结束
 func (d *LogWriter) Close() {
 	close(d.exit)
 	d.Wait()
+	d.archive.Done()
+	d.archive.Wait()
 }
 
 func (d *LogWriter) run() {
 	tt := time.NewTicker(3 * time.Second)
 	defer func() {
 		tt.Stop()
-		for mm := d.datas.Pop(); mm != nil; mm = d.datas.Pop() {
-			d.cache.Set(d.getFileName(mm))
-			d.cache.Write(mm.Read())
-			put(mm)
-		}
+		d.write()
 		d.cache.Flush()
 		d.cache.Close()
 		d.Done()
@@ -78,11 +125,7 @@ func (d *LogWriter) run() {
 	for {
 		select {
 		case <-d.notify:
-			for mm := d.datas.Pop(); mm != nil; mm = d.datas.Pop() {
-				d.cache.Set(d.getFileName(mm))
-				d.cache.Write(mm.Read())
-				put(mm)
-			}
+			d.write()
 		case <-tt.C:
 			d.cache.Flush()
 		case <-d.exit:
@@ -91,7 +134,18 @@ func (d *LogWriter) run() {
 	}
 }
 
-func (d *LogWriter) getFileName(m IData) string {
-	tt := m.Now()
-	return path.Join(d.lpath, fmt.Sprintf("%s_%04d%02d%02d.log", d.lname, tt.Year(), tt.Month(), tt.Day()))
+// 批量取出日志写入缓存
+func (d *LogWriter) write() {
+	d.buffer = d.datas.Drain(d.buffer[:0])
+	for i, mm := range d.buffer {
+		d.switchFile(mm)
+		if d.encoder != nil {
+			d.encoded = d.encoder.Encode(d.encoded[:0], mm.Now(), mm.GetMeta())
+			d.cache.Write(d.encoded)
+		} else {
+			d.cache.Write(mm.Read())
+		}
+		put(mm)
+		d.buffer[i] = nil
+	}
 }
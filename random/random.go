@@ -2,10 +2,35 @@ package random
 
 import (
 	"math/rand"
+	"sync"
 	"time"
 )
 
-var randObj = rand.New(rand.NewSource(time.Now().UnixNano()))
+// rand.Rand并发不安全, 使用加锁的随机源
+var randObj = rand.New(&lockedSource{src: rand.NewSource(time.Now().UnixNano()).(rand.Source64)})
+
+type lockedSource struct {
+	mutex sync.Mutex
+	src   rand.Source64
+}
+
+func (d *lockedSource) Int63() int64 {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.src.Int63()
+}
+
+func (d *lockedSource) Uint64() uint64 {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.src.Uint64()
+}
+
+func (d *lockedSource) Seed(seed int64) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.src.Seed(seed)
+}
 
 // [0,n)
 func Intn(n int) int {
@@ -0,0 +1,162 @@
+package timer
+
+import (
+	"sync"
+	"time"
+)
+
+// 时钟, 用于驱动Timer
+type IClock interface {
+	Now() time.Time
+	NewTicker(time.Duration) ITicker
+}
+
+type ITicker interface {
+	C() <-chan time.Time
+	Done() // 一次tick处理完毕
+	Stop()
+}
+
+// 真实时钟
+type RealClock struct{}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+func (RealClock) NewTicker(d time.Duration) ITicker {
+	return &realTicker{time.NewTicker(d)}
+}
+
+func (d *realTicker) C() <-chan time.Time {
+	return d.Ticker.C
+}
+
+func (d *realTicker) Done() {}
+
+// 模拟时钟, 只能通过Advance推进, 用于测试
+type FakeClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+type fakeTicker struct {
+	period time.Duration
+	next   time.Time
+	ch     chan time.Time
+	ack    chan struct{}
+	stop   chan struct{}
+	once   sync.Once
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (d *FakeClock) Now() time.Time {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.now
+}
+
+func (d *FakeClock) NewTicker(period time.Duration) ITicker {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	ret := &fakeTicker{
+		period: period,
+		next:   d.now.Add(period),
+		ch:     make(chan time.Time),
+		ack:    make(chan struct{}),
+		stop:   make(chan struct{}),
+	}
+	d.tickers = append(d.tickers, ret)
+	return ret
+}
+
+// 推进时间, 按顺序逐个触发到期的tick, 每个tick处理完毕后才返回
+func (d *FakeClock) Advance(diff time.Duration) {
+	d.mutex.Lock()
+	target := d.now.Add(diff)
+	d.mutex.Unlock()
+	for {
+		d.mutex.Lock()
+		var tt *fakeTicker
+		for _, item := range d.tickers {
+			if !item.isStopped() && !item.next.After(target) && (tt == nil || item.next.Before(tt.next)) {
+				tt = item
+			}
+		}
+		if tt == nil {
+			d.now = target
+			d.mutex.Unlock()
+			return
+		}
+		d.now = tt.next
+		tt.next = tt.next.Add(tt.period)
+		now := d.now
+		d.mutex.Unlock()
+		tt.fire(now)
+	}
+}
+
+// 模拟进程停顿diff: 期间的tick全部丢失, 恢复后每个ticker只收到一次tick(与time.Ticker一致)
+func (d *FakeClock) Stall(diff time.Duration) {
+	d.mutex.Lock()
+	d.now = d.now.Add(diff)
+	now := d.now
+	fires := []*fakeTicker{}
+	for _, item := range d.tickers {
+		if item.isStopped() || item.next.After(now) {
+			continue
+		}
+		for !item.next.After(now) {
+			item.next = item.next.Add(item.period)
+		}
+		fires = append(fires, item)
+	}
+	d.mutex.Unlock()
+	for _, item := range fires {
+		item.fire(now)
+	}
+}
+
+func (d *fakeTicker) isStopped() bool {
+	select {
+	case <-d.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (d *fakeTicker) fire(now time.Time) {
+	select {
+	case d.ch <- now:
+	case <-d.stop:
+		return
+	}
+	select {
+	case <-d.ack:
+	case <-d.stop:
+	}
+}
+
+func (d *fakeTicker) C() <-chan time.Time {
+	return d.ch
+}
+
+func (d *fakeTicker) Done() {
+	select {
+	case d.ack <- struct{}{}:
+	case <-d.stop:
+	}
+}
+
+func (d *fakeTicker) Stop() {
+	d.once.Do(func() { close(d.stop) })
+}
@@ -0,0 +1,64 @@
+package timer
+
+import (
+	"math/bits"
+	"time"
+
+	"github.com/hechh/library/uerror"
+)
+
+// 定时器配置, 零值字段使用默认值
+//
+// 时间轮共len(Wheels)层, 第i层有1<<Wheels[i]个桶, 每个桶跨度为前面各层桶数之积乘以Tick,
+// 所以能容纳的最大时长为 Tick * 2^(Wheels之和), 超出的任务进入溢出堆(插入和弹出为O(logN)).
+// 默认Tick=16ms, Wheels=[12,5,5,5,5], 第一层约65s, 总范围约2.2年
+type Config struct {
+	Tick     time.Duration // 精度, 必须是2的幂毫秒数(1ms, 2ms, 4ms...1024ms), 默认16ms
+	Wheels   []int         // 各层时间轮的位数, 每层[1,16], 默认[12,5,5,5,5]
+	MaxTTL   time.Duration // 期望支持的最大间隔, 大于0时校验时间轮范围不小于它
+	Clock    IClock        // 时钟, 默认RealClock
+	CatchUp  int32         // 追赶策略, 默认CATCHUP_ALL
+	MaxFires int32         // 每个tick最多触发的任务数, <=0不限制
+}
+
+const (
+	maxWheelBits = 16 // 单层时间轮的最大位数
+	maxRangeBits = 48 // 时间轮范围上限(毫秒的位数), 约8900年
+)
+
+// 按配置创建定时器
+func NewTimerWithConfig(cfg Config) (*Timer, error) {
+	if cfg.Tick <= 0 {
+		cfg.Tick = 16 * time.Millisecond
+	}
+	if len(cfg.Wheels) <= 0 {
+		cfg.Wheels = []int{12, 5, 5, 5, 5}
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = RealClock{}
+	}
+
+	ms := cfg.Tick.Milliseconds()
+	if cfg.Tick%time.Millisecond != 0 || ms <= 0 || ms&(ms-1) != 0 || ms > 1024 {
+		return nil, uerror.New(-1, "定时器精度必须是2的幂毫秒数且不超过1024ms: %v", cfg.Tick)
+	}
+	shift := int64(bits.TrailingZeros64(uint64(ms)))
+	total := shift
+	for _, bit := range cfg.Wheels {
+		if bit < 1 || bit > maxWheelBits {
+			return nil, uerror.New(-1, "时间轮位数必须在[1,%d]之间: %v", maxWheelBits, cfg.Wheels)
+		}
+		total += int64(bit)
+	}
+	if total > maxRangeBits {
+		return nil, uerror.New(-1, "时间轮范围超出上限: %v", cfg.Wheels)
+	}
+	if limit := time.Duration(int64(1)<<total) * time.Millisecond; cfg.MaxTTL > limit {
+		return nil, uerror.New(-1, "时间轮范围%v小于期望的最大间隔%v", limit, cfg.MaxTTL)
+	}
+
+	ret := newTimer(cfg.Clock, shift, cfg.Wheels)
+	ret.SetCatchUp(cfg.CatchUp)
+	ret.SetMaxFires(cfg.MaxFires)
+	return ret, nil
+}
@@ -0,0 +1,291 @@
+package timer
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hechh/library/async"
+	"github.com/hechh/library/uerror"
+	"github.com/hechh/library/util"
+)
+
+var (
+	cronAlias = map[string]string{
+		"@yearly":   "0 0 0 1 1 *",
+		"@annually": "0 0 0 1 1 *",
+		"@monthly":  "0 0 0 1 * *",
+		"@weekly":   "0 0 0 * * 0",
+		"@daily":    "0 0 0 * * *",
+		"@midnight": "0 0 0 * * *",
+		"@hourly":   "0 0 * * * *",
+	}
+	monthNames = map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}
+	weekNames = map[string]int{
+		"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+	}
+)
+
+// cron表达式解析结果, 每个字段用位图表示
+type Schedule struct {
+	second  uint64
+	minute  uint64
+	hour    uint64
+	dom     uint64
+	month   uint64
+	dow     uint64
+	domStar bool // 日期字段为*
+	dowStar bool // 星期字段为*
+	loc     *time.Location
+}
+
+// 解析cron表达式, 支持5字段(分 时 日 月 周)、6字段(秒 分 时 日 月 周)和@daily等别名
+// loc为nil时使用time.Local
+func ParseCron(spec string, loc *time.Location) (*Schedule, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	spec = strings.TrimSpace(spec)
+	if alias, ok := cronAlias[strings.ToLower(spec)]; ok {
+		spec = alias
+	}
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, uerror.New(-1, "cron表达式字段数错误: %s", spec)
+	}
+
+	ret := &Schedule{loc: loc}
+	var err error
+	if ret.second, err = parseField(fields[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if ret.minute, err = parseField(fields[1], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if ret.hour, err = parseField(fields[2], 0, 23, nil); err != nil {
+		return nil, err
+	}
+	if ret.dom, err = parseField(fields[3], 1, 31, nil); err != nil {
+		return nil, err
+	}
+	if ret.month, err = parseField(fields[4], 1, 12, monthNames); err != nil {
+		return nil, err
+	}
+	if ret.dow, err = parseField(fields[5], 0, 7, weekNames); err != nil {
+		return nil, err
+	}
+	// 周日可以写成7
+	if ret.dow&(1<<7) > 0 {
+		ret.dow = ret.dow&^(1<<7) | 1
+	}
+	ret.domStar = fields[3] == "*" || fields[3] == "?"
+	ret.dowStar = fields[5] == "*" || fields[5] == "?"
+	return ret, nil
+}
+
+// 解析单个字段: *, ?, a, a-b, */n, a-b/n, a/n 以及逗号分隔的组合
+func parseField(field string, minVal, maxVal int, names map[string]int) (ret uint64, err error) {
+	for _, item := range strings.Split(field, ",") {
+		step := 1
+		if pos := strings.Index(item, "/"); pos >= 0 {
+			if step, err = strconv.Atoi(item[pos+1:]); err != nil || step <= 0 {
+				return 0, uerror.New(-1, "cron步长错误: %s", field)
+			}
+			item = item[:pos]
+		}
+		begin, end := minVal, maxVal
+		switch {
+		case item == "*" || item == "?":
+		case strings.Contains(item, "-"):
+			pos := strings.Index(item, "-")
+			if begin, err = parseValue(item[:pos], names); err != nil {
+				return 0, err
+			}
+			if end, err = parseValue(item[pos+1:], names); err != nil {
+				return 0, err
+			}
+		default:
+			if begin, err = parseValue(item, names); err != nil {
+				return 0, err
+			}
+			// a/n表示从a开始到最大值
+			if step == 1 {
+				end = begin
+			}
+		}
+		if begin < minVal || end > maxVal || begin > end {
+			return 0, uerror.New(-1, "cron字段超出范围[%d,%d]: %s", minVal, maxVal, field)
+		}
+		for i := begin; i <= end; i += step {
+			ret |= 1 << uint(i)
+		}
+	}
+	return
+}
+
+func parseValue(str string, names map[string]int) (int, error) {
+	if val, ok := names[strings.ToUpper(str)]; ok {
+		return val, nil
+	}
+	val, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, uerror.New(-1, "cron字段值错误: %s", str)
+	}
+	return val, nil
+}
+
+func (d *Schedule) matchDay(w time.Time) bool {
+	dom := d.dom&(1<<uint(w.Day())) > 0
+	dow := d.dow&(1<<uint(w.Weekday())) > 0
+	if d.domStar || d.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// 计算t之后的下一次触发时间, 5年内没有匹配返回零值
+// 在挂钟时间上搜索再转换到时区: 夏令时跳过的时刻在跳变后立即触发(同Vixie cron), 重复的时刻只触发一次
+func (d *Schedule) Next(t time.Time) time.Time {
+	t = t.In(d.loc)
+	w := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC).Add(time.Second)
+	limit := w.AddDate(5, 0, 0)
+	for w.Before(limit) {
+		if d.month&(1<<uint(w.Month())) <= 0 {
+			w = time.Date(w.Year(), w.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !d.matchDay(w) {
+			w = time.Date(w.Year(), w.Month(), w.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if d.hour&(1<<uint(w.Hour())) <= 0 {
+			w = time.Date(w.Year(), w.Month(), w.Day(), w.Hour()+1, 0, 0, 0, time.UTC)
+			continue
+		}
+		if d.minute&(1<<uint(w.Minute())) <= 0 {
+			w = time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute()+1, 0, 0, time.UTC)
+			continue
+		}
+		if d.second&(1<<uint(w.Second())) <= 0 {
+			w = w.Add(time.Second)
+			continue
+		}
+		ret := time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), w.Second(), 0, d.loc)
+		if ret.Hour() != w.Hour() || ret.Minute() != w.Minute() {
+			// 夏令时跳过的时刻, 在跳变后的第一个时刻触发(ret可能被规范到跳变前或跳变后)
+			start, end := ret.ZoneBounds()
+			wall := time.Date(ret.Year(), ret.Month(), ret.Day(), ret.Hour(), ret.Minute(), ret.Second(), 0, time.UTC)
+			ret = util.Or(wall.Before(w), end, start)
+		}
+		if ret.After(t) {
+			return ret
+		}
+		w = w.Add(time.Second)
+	}
+	return time.Time{}
+}
+
+// cron任务句柄
+type CronHandle struct {
+	mutex    sync.Mutex
+	timer    *Timer
+	schedule *Schedule
+	exec     IExecutor
+	event    func()
+	handle   *Handle   // 当前时间轮上的任务
+	next     time.Time // 下次触发时间
+	fired    int32
+	status   int32 // 1表示已取消
+}
+
+func RegisterCron(spec string, f func()) (*CronHandle, error) {
+	return Default().RegisterCron(spec, nil, nil, f)
+}
+
+// 注册cron任务, loc为nil时使用time.Local, e不为nil时回调投递到e上执行
+func (d *Timer) RegisterCron(spec string, loc *time.Location, e IExecutor, f func()) (*CronHandle, error) {
+	sch, err := ParseCron(spec, loc)
+	if err != nil {
+		return nil, err
+	}
+	next := sch.Next(d.clock.Now())
+	if next.IsZero() {
+		return nil, uerror.New(-1, "cron表达式没有可触发的时间: %s", spec)
+	}
+	ret := &CronHandle{timer: d, schedule: sch, exec: e, event: f, next: next}
+	ret.mutex.Lock()
+	defer ret.mutex.Unlock()
+	if err := ret.arm(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// 按下次触发时间注册单次任务, 需持有锁
+func (d *CronHandle) arm() error {
+	ttl := max(d.next.Sub(d.timer.clock.Now()).Milliseconds(), int64(1)<<d.timer.head.shift)
+	hh, err := d.timer.Register(time.Duration(ttl)*time.Millisecond, 1, d.onTimer)
+	if err != nil {
+		return err
+	}
+	d.handle = hh
+	return nil
+}
+
+// 在时间轮协程上执行, 先在锁内计算并注册下次触发, 解锁后再执行回调, 回调中可以调用Cancel和Next
+func (d *CronHandle) onTimer() {
+	d.mutex.Lock()
+	if atomic.LoadInt32(&d.status) > 0 {
+		d.mutex.Unlock()
+		return
+	}
+	// 时间轮与挂钟有偏差导致提前触发, 继续等待
+	tick := time.Duration(1<<d.timer.head.shift) * time.Millisecond
+	if d.next.Sub(d.timer.clock.Now()) >= tick {
+		d.arm()
+		d.mutex.Unlock()
+		return
+	}
+	atomic.AddInt32(&d.fired, 1)
+	if d.next = d.schedule.Next(d.next); !d.next.IsZero() {
+		d.arm()
+	}
+	d.mutex.Unlock()
+
+	if d.exec != nil {
+		d.exec.Push(d.event)
+	} else {
+		async.Recover(d.event)
+	}
+}
+
+// 取消cron任务
+func (d *CronHandle) Cancel() {
+	atomic.StoreInt32(&d.status, 1)
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.handle != nil {
+		d.handle.Cancel()
+	}
+}
+
+// 下次触发时间
+func (d *CronHandle) Next() time.Time {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.next
+}
+
+// 已触发次数
+func (d *CronHandle) GetFired() int32 {
+	return atomic.LoadInt32(&d.fired)
+}
@@ -0,0 +1,215 @@
+package timer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hechh/library/async"
+)
+
+// 防抖: 连续调用时, 停止调用wait之后才执行一次
+// 默认只在末尾执行(trailing), 可开启首次调用立即执行(leading), maxWait限制连续调用时的最长等待
+type Debouncer struct {
+	mutex    sync.Mutex
+	timer    *Timer
+	exec     IExecutor // 回调执行器, nil表示在调用方或时间轮协程上执行
+	event    func()
+	wait     time.Duration
+	maxWait  time.Duration // 连续调用时的最长等待, 0表示不限制
+	leading  bool
+	trailing bool
+	handle   *Handle   // 本轮的定时任务, nil表示空闲
+	first    time.Time // 本轮第一次调用的时间
+	pending  bool      // 有待执行的调用
+	round    uint64    // 轮次, 防止已结束轮次的定时任务生效
+}
+
+// t为nil时使用全局默认定时器
+func NewDebouncer(t *Timer, wait time.Duration, f func()) *Debouncer {
+	if t == nil {
+		t = Default()
+	}
+	return &Debouncer{timer: t, event: f, wait: wait, trailing: true}
+}
+
+// 设置触发边沿, 需在Call之前调用
+func (d *Debouncer) SetEdge(leading, trailing bool) {
+	d.leading, d.trailing = leading, trailing
+}
+
+// 设置最长等待, 需在Call之前调用
+func (d *Debouncer) SetMaxWait(maxWait time.Duration) {
+	d.maxWait = maxWait
+}
+
+// 设置回调执行器, 需在Call之前调用
+func (d *Debouncer) SetExecutor(e IExecutor) {
+	d.exec = e
+}
+
+func (d *Debouncer) Call() error {
+	d.mutex.Lock()
+	now := d.timer.clock.Now()
+	if d.handle == nil {
+		d.round++
+		round := d.round
+		hh, err := d.timer.Register(d.timer.minTTL(d.wait), 1, func() { d.onTimer(round) })
+		if err != nil {
+			d.mutex.Unlock()
+			return err
+		}
+		d.handle, d.first, d.pending = hh, now, !d.leading
+		d.mutex.Unlock()
+		if d.leading {
+			invoke(d.exec, d.event)
+		}
+		return nil
+	}
+	defer d.mutex.Unlock()
+	d.pending = true
+	delay := d.wait
+	if d.maxWait > 0 {
+		delay = min(delay, d.first.Add(d.maxWait).Sub(now))
+	}
+	return d.handle.Reset(d.timer.minTTL(delay))
+}
+
+// 立即执行待执行的调用并结束本轮
+func (d *Debouncer) Flush() {
+	d.mutex.Lock()
+	pending := d.stop()
+	d.mutex.Unlock()
+	if pending {
+		invoke(d.exec, d.event)
+	}
+}
+
+// 放弃待执行的调用并结束本轮
+func (d *Debouncer) Cancel() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.stop()
+}
+
+// 结束本轮, 返回是否有待执行的调用
+func (d *Debouncer) stop() bool {
+	if d.handle != nil {
+		d.handle.Cancel()
+		d.handle = nil
+	}
+	pending := d.pending && d.trailing
+	d.pending = false
+	return pending
+}
+
+// 在时间轮协程上执行
+func (d *Debouncer) onTimer(round uint64) {
+	d.mutex.Lock()
+	if d.round != round || d.handle == nil {
+		d.mutex.Unlock()
+		return
+	}
+	pending := d.pending && d.trailing
+	d.handle, d.pending = nil, false
+	d.mutex.Unlock()
+	if pending {
+		invoke(d.exec, d.event)
+	}
+}
+
+// 节流: 每个interval内最多执行一次
+// 默认首次调用立即执行(leading), 窗口内的调用在窗口结束时再执行一次(trailing)
+type Throttler struct {
+	mutex    sync.Mutex
+	timer    *Timer
+	exec     IExecutor // 回调执行器, nil表示在调用方或时间轮协程上执行
+	event    func()
+	interval time.Duration
+	leading  bool
+	trailing bool
+	handle   *Handle // 当前窗口的定时任务, nil表示空闲
+	pending  bool    // 窗口内有待执行的调用
+	round    uint64  // 窗口轮次, 防止已结束窗口的定时任务生效
+}
+
+// t为nil时使用全局默认定时器
+func NewThrottler(t *Timer, interval time.Duration, f func()) *Throttler {
+	if t == nil {
+		t = Default()
+	}
+	return &Throttler{timer: t, event: f, interval: interval, leading: true, trailing: true}
+}
+
+// 设置触发边沿, 需在Call之前调用
+func (d *Throttler) SetEdge(leading, trailing bool) {
+	d.leading, d.trailing = leading, trailing
+}
+
+// 设置回调执行器, 需在Call之前调用
+func (d *Throttler) SetExecutor(e IExecutor) {
+	d.exec = e
+}
+
+func (d *Throttler) Call() error {
+	d.mutex.Lock()
+	if d.handle != nil {
+		d.pending = true
+		d.mutex.Unlock()
+		return nil
+	}
+	hh, err := d.open()
+	if err != nil {
+		d.mutex.Unlock()
+		return err
+	}
+	d.handle, d.pending = hh, !d.leading
+	d.mutex.Unlock()
+	if d.leading {
+		invoke(d.exec, d.event)
+	}
+	return nil
+}
+
+// 放弃待执行的调用并结束当前窗口
+func (d *Throttler) Cancel() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.handle != nil {
+		d.handle.Cancel()
+		d.handle = nil
+	}
+	d.pending = false
+}
+
+// 开启新窗口, 需持有锁
+func (d *Throttler) open() (*Handle, error) {
+	d.round++
+	round := d.round
+	return d.timer.Register(d.timer.minTTL(d.interval), 1, func() { d.onTimer(round) })
+}
+
+// 在时间轮协程上执行, 窗口末尾执行后开启新窗口, 保证两次执行的间隔
+func (d *Throttler) onTimer(round uint64) {
+	d.mutex.Lock()
+	if d.round != round || d.handle == nil {
+		d.mutex.Unlock()
+		return
+	}
+	pending := d.pending && d.trailing
+	d.handle, d.pending = nil, false
+	if pending {
+		d.handle, _ = d.open()
+	}
+	d.mutex.Unlock()
+	if pending {
+		invoke(d.exec, d.event)
+	}
+}
+
+func invoke(e IExecutor, f func()) {
+	if e != nil {
+		e.Push(f)
+	} else {
+		async.Recover(f)
+	}
+}
@@ -0,0 +1,134 @@
+package timer
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/hechh/library/async"
+	"github.com/hechh/library/uerror"
+)
+
+// 回调执行器, async.Async和async.AsyncPool均已实现
+type IExecutor interface {
+	Push(func())
+}
+
+// 定时任务句柄, 所有方法并发安全
+type Handle struct {
+	timer    *Timer
+	exec     IExecutor // 回调执行器, nil表示在时间轮协程上执行
+	event    func()
+	strategy IStrategy // 间隔策略, nil表示固定间隔
+	ttl      int64     // 触发间隔(ms)
+	times    int32     // 剩余次数, <0表示无限次
+	fired    int32     // 已触发次数
+	expire   int64     // 下次触发时间(ms)
+	seq      uint32    // 版本号, Reset后旧节点失效
+	status   int32     // 1表示已取消
+	round    uint64    // 最近一次触发时的追赶轮次, 仅在时间轮协程中访问
+	label    atomic.Pointer[string]
+}
+
+func (d *Handle) isEnable(seq uint32) bool {
+	return atomic.LoadUint32(&d.seq) == seq && atomic.LoadInt32(&d.status) == 0 && atomic.LoadInt32(&d.times) != 0
+}
+
+// 按策略计算下次触发的间隔(ms), 不小于一个tick
+func (d *Handle) interval() int64 {
+	return d.intervalAt(atomic.LoadInt32(&d.fired))
+}
+
+// 已触发fired次后的间隔(ms)
+func (d *Handle) intervalAt(fired int32) int64 {
+	ttl := atomic.LoadInt64(&d.ttl)
+	if d.strategy == nil {
+		return ttl
+	}
+	ret := d.strategy.Next(time.Duration(ttl)*time.Millisecond, fired)
+	return max(ret.Milliseconds(), int64(1)<<d.timer.head.shift)
+}
+
+// 执行回调, 返回是否还需要继续触发
+func (d *Handle) fire() bool {
+	if d.exec != nil {
+		d.exec.Push(func() {
+			// 投递后被取消则不再执行
+			if !d.IsCanceled() {
+				d.event()
+			}
+		})
+	} else {
+		async.Recover(d.event)
+	}
+	atomic.AddInt32(&d.fired, 1)
+	for {
+		times := atomic.LoadInt32(&d.times)
+		if times <= 0 {
+			return times != 0
+		}
+		if atomic.CompareAndSwapInt32(&d.times, times, times-1) {
+			return times-1 != 0
+		}
+	}
+}
+
+// 取消任务
+func (d *Handle) Cancel() {
+	atomic.StoreInt32(&d.status, 1)
+}
+
+// 是否已取消
+func (d *Handle) IsCanceled() bool {
+	return atomic.LoadInt32(&d.status) == 1
+}
+
+// 是否仍在等待触发
+func (d *Handle) IsActive() bool {
+	return atomic.LoadInt32(&d.status) == 0 && atomic.LoadInt32(&d.times) != 0
+}
+
+// 以新的间隔重新计时, 剩余次数不变
+func (d *Handle) Reset(ttl time.Duration) error {
+	if !d.IsActive() {
+		return uerror.New(-1, "定时任务已结束")
+	}
+	tt, err := d.timer.check(ttl)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt64(&d.ttl, tt)
+	d.timer.push(d, atomic.AddUint32(&d.seq, 1), d.interval())
+	return nil
+}
+
+// 距离下次触发的剩余时间, 已结束返回0
+func (d *Handle) Remaining() time.Duration {
+	if !d.IsActive() {
+		return 0
+	}
+	diff := atomic.LoadInt64(&d.expire) - atomic.LoadInt64(&d.timer.lastTime)
+	return time.Duration(max(diff, 0)) * time.Millisecond
+}
+
+// 设置标签, 用于快照中识别任务, 带标签的任务才能通过Restore恢复
+func (d *Handle) SetLabel(label string) *Handle {
+	d.label.Store(&label)
+	return d
+}
+
+func (d *Handle) GetLabel() string {
+	if label := d.label.Load(); label != nil {
+		return *label
+	}
+	return ""
+}
+
+// 已触发次数
+func (d *Handle) GetFired() int32 {
+	return atomic.LoadInt32(&d.fired)
+}
+
+// 剩余次数, <0表示无限次
+func (d *Handle) GetTimes() int32 {
+	return atomic.LoadInt32(&d.times)
+}
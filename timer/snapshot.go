@@ -0,0 +1,199 @@
+package timer
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/hechh/library/crypto"
+	"github.com/hechh/library/uerror"
+	"github.com/hechh/library/util"
+)
+
+var (
+	ErrClosed = uerror.Err(-1, "定时器已关闭")
+)
+
+// 快照编码器
+type IEncoder interface {
+	Marshal(any) ([]byte, error)
+	Unmarshal([]byte, any) error
+}
+
+// 使用crypto包的gob工具编码
+type GobEncoder struct{}
+
+func (GobEncoder) Marshal(v any) ([]byte, error) {
+	return crypto.GobEncrypto(v)
+}
+
+func (GobEncoder) Unmarshal(data []byte, v any) error {
+	return crypto.GobDecrypto(data, v)
+}
+
+// 待触发任务信息
+type TaskInfo struct {
+	Label     string
+	Next      time.Time     // 下次触发时间
+	Remaining time.Duration // 距离下次触发的时长
+	Interval  time.Duration // 触发间隔
+	Times     int32         // 剩余次数, <0表示无限次
+	Fired     int32         // 已触发次数
+	Wheel     int           // 所在时间轮层级, -1表示溢出堆
+}
+
+// 定时器快照
+type Snapshot struct {
+	Time     time.Time
+	Tasks    []TaskInfo // 按下次触发时间排序
+	Wheels   []int      // 各层时间轮的任务数
+	Overflow int        // 溢出堆的任务数
+}
+
+func (d *Snapshot) Encode(enc IEncoder) ([]byte, error) {
+	return enc.Marshal(d)
+}
+
+func DecodeSnapshot(enc IEncoder, data []byte) (*Snapshot, error) {
+	ret := &Snapshot{}
+	if err := enc.Unmarshal(data, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// 获取待触发任务的快照, 在时间轮协程上生成
+// 可在时间轮协程执行的回调中调用, 此时直接生成, 正在执行的任务按本次触发后的状态记录
+func (d *Timer) Snapshot() (*Snapshot, error) {
+	if d.inLoop() {
+		return d.snapshot(), nil
+	}
+	ch := make(chan *Snapshot, 1)
+	select {
+	case d.snaps <- ch:
+	case <-d.exit:
+		return nil, ErrClosed
+	}
+	return <-ch, nil
+}
+
+func (d *Timer) snapshot() *Snapshot {
+	d.accept()
+	d.flush()
+	ret := &Snapshot{Time: d.clock.Now(), Wheels: make([]int, len(d.wheels))}
+	for i, w := range d.wheels {
+		for _, head := range w.buckets {
+			for tt := head; tt != nil; tt = tt.next {
+				if tt.IsEnable() {
+					ret.Wheels[i]++
+					ret.Tasks = append(ret.Tasks, d.newTaskInfo(tt, ret.Time, i))
+				}
+			}
+		}
+	}
+	for _, tt := range d.overflow {
+		if tt.IsEnable() {
+			ret.Overflow++
+			ret.Tasks = append(ret.Tasks, d.newTaskInfo(tt, ret.Time, -1))
+		}
+	}
+	// 回调中生成快照时, 本tick取出的任务尚未放回时间轮
+	for tt := d.pending; tt != nil; tt = tt.next {
+		if tt.IsEnable() {
+			ret.Wheels[0]++
+			ret.Tasks = append(ret.Tasks, d.newTaskInfo(tt, ret.Time, 0))
+		}
+	}
+	if tt := d.firing; tt != nil && tt.IsEnable() {
+		if item, ok := d.firingTaskInfo(tt, ret.Time); ok {
+			ret.Wheels[0]++
+			ret.Tasks = append(ret.Tasks, item)
+		}
+	}
+	sort.SliceStable(ret.Tasks, func(i, j int) bool {
+		return ret.Tasks[i].Next.Before(ret.Tasks[j].Next)
+	})
+	return ret
+}
+
+// 取消并清空所有任务, 返回清空前未触发的任务, 时间轮协程退出时调用
+func (d *Timer) drain() []TaskInfo {
+	rets := d.snapshot().Tasks
+	for _, w := range d.wheels {
+		for i, head := range w.buckets {
+			for tt := head; tt != nil; tt = tt.next {
+				tt.owner.Cancel()
+			}
+			w.buckets[i] = nil
+		}
+	}
+	for _, tt := range d.overflow {
+		tt.owner.Cancel()
+	}
+	d.overflow = nil
+	return rets
+}
+
+func (d *Timer) newTaskInfo(tt *Task, now time.Time, wheel int) TaskInfo {
+	next := d.startAt.Add(time.Duration(tt.expire-d.startTime) * time.Millisecond)
+	return TaskInfo{
+		Label:     tt.owner.GetLabel(),
+		Next:      next,
+		Remaining: max(next.Sub(now), 0),
+		Interval:  time.Duration(atomic.LoadInt64(&tt.owner.ttl)) * time.Millisecond,
+		Times:     tt.owner.GetTimes(),
+		Fired:     tt.owner.GetFired(),
+		Wheel:     wheel,
+	}
+}
+
+// 正在执行回调的任务, 按本次触发后的次数和下次触发时间记录, 已是最后一次返回false
+func (d *Timer) firingTaskInfo(tt *Task, now time.Time) (TaskInfo, bool) {
+	ret := d.newTaskInfo(tt, now, 0)
+	if ret.Times == 1 {
+		return ret, false
+	}
+	if ret.Times > 0 {
+		ret.Times--
+	}
+	ret.Fired++
+	expire := atomic.LoadInt64(&d.lastTime) + tt.owner.intervalAt(ret.Fired)
+	ret.Next = d.startAt.Add(time.Duration(expire-d.startTime) * time.Millisecond)
+	ret.Remaining = max(ret.Next.Sub(now), 0)
+	return ret, true
+}
+
+// 是否在时间轮协程中调用
+func (d *Timer) inLoop() bool {
+	return atomic.LoadUint64(&d.goid) == util.GetGoId()
+}
+
+// 按快照重新注册带标签的任务, 用于重启后恢复持久化的定时器
+// 剩余时间按快照中的触发时间计算, 停机期间已到期的任务尽快触发
+// bind根据标签返回回调和间隔策略(nil表示固定间隔), 回调为nil表示不恢复该任务, e不为nil时回调投递到e上执行
+func (d *Timer) Restore(snap *Snapshot, e IExecutor, bind func(label string) (func(), IStrategy)) ([]*Handle, error) {
+	if atomic.LoadInt32(&d.status) > 0 {
+		return nil, ErrClosed
+	}
+	now := d.clock.Now()
+	rets := []*Handle{}
+	for _, item := range snap.Tasks {
+		if len(item.Label) <= 0 || item.Times == 0 {
+			continue
+		}
+		f, s := bind(item.Label)
+		if f == nil {
+			continue
+		}
+		ttl, err := d.check(item.Interval)
+		if err != nil {
+			return rets, err
+		}
+		delay := max(item.Next.Sub(now).Milliseconds(), int64(1)<<d.head.shift)
+		hh := &Handle{timer: d, exec: e, event: f, ttl: ttl, times: item.Times, fired: item.Fired, strategy: s}
+		hh.SetLabel(item.Label)
+		d.push(hh, 0, delay)
+		rets = append(rets, hh)
+	}
+	return rets, nil
+}
@@ -0,0 +1,49 @@
+package timer
+
+import (
+	"time"
+
+	"github.com/hechh/library/random"
+)
+
+// 重复任务的间隔策略
+type IStrategy interface {
+	// 已触发fired次后距离下次触发的间隔, ttl为注册时的间隔
+	Next(ttl time.Duration, fired int32) time.Duration
+}
+
+// 固定间隔
+type FixedStrategy struct{}
+
+func (FixedStrategy) Next(ttl time.Duration, fired int32) time.Duration {
+	return ttl
+}
+
+// 固定间隔加上[-Jitter, Jitter]的随机抖动, 首次触发同样抖动, 用于打散同时注册的任务
+type JitterStrategy struct {
+	Jitter time.Duration
+}
+
+func (d JitterStrategy) Next(ttl time.Duration, fired int32) time.Duration {
+	if d.Jitter <= 0 {
+		return ttl
+	}
+	return ttl + time.Duration(random.Int64Part(-int64(d.Jitter), int64(d.Jitter)))
+}
+
+// 指数退避, 间隔依次为ttl, ttl*Factor, ttl*Factor^2..., 不超过Max
+type BackoffStrategy struct {
+	Factor float64
+	Max    time.Duration
+}
+
+func (d BackoffStrategy) Next(ttl time.Duration, fired int32) time.Duration {
+	ret := float64(ttl)
+	for i := int32(0); i < fired && (d.Max <= 0 || ret < float64(d.Max)); i++ {
+		ret *= d.Factor
+	}
+	if d.Max > 0 && ret > float64(d.Max) {
+		return d.Max
+	}
+	return time.Duration(ret)
+}
@@ -1,9 +1,10 @@
 package timer
 
 import (
-	"fmt"
-
+	"container/heap"
+	"math/bits"
 	"sort"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -13,22 +14,67 @@ import (
 )
 
 var (
-	timerObj = NewTimer(4, 5)
+	timerObj atomic.Pointer[Timer] // 全局默认定时器
 )
 
-func Register(taskId *uint64, ttl time.Duration, times int32, f func()) error {
-	return timerObj.Register(taskId, ttl, times, f)
+func init() {
+	timerObj.Store(NewTimer(4, 5))
+}
+
+// 全局默认定时器
+func Default() *Timer {
+	return timerObj.Load()
+}
+
+// 替换全局默认定时器, 返回旧的定时器(由调用方决定是否Close), 应在启动阶段调用
+func SetDefault(t *Timer) *Timer {
+	return timerObj.Swap(t)
+}
+
+func Register(ttl time.Duration, times int32, f func()) (*Handle, error) {
+	return Default().Register(ttl, times, f)
+}
+
+func RegisterOn(e IExecutor, ttl time.Duration, times int32, f func()) (*Handle, error) {
+	return Default().RegisterOn(e, ttl, times, f)
+}
+
+func RegisterWith(e IExecutor, s IStrategy, ttl time.Duration, times int32, f func()) (*Handle, error) {
+	return Default().RegisterWith(e, s, ttl, times, f)
+}
+
+func Close() []TaskInfo {
+	return Default().Close()
+}
+
+func SetCatchUp(policy int32) {
+	Default().SetCatchUp(policy)
 }
 
-func Close() {
-	timerObj.Close()
+func GetLagStats() LagStats {
+	return Default().GetLagStats()
 }
 
+// 时间轮落后于挂钟(GC、CPU争用导致丢tick)时的追赶策略
+const (
+	CATCHUP_ALL      = 0 // 逐个补齐错过的tick, 周期任务补触发每一次
+	CATCHUP_COALESCE = 1 // 错过的多次触发合并为一次
+	CATCHUP_SKIP     = 2 // 丢弃周期任务错过的触发, 单次任务仍然补触发
+)
+
+// 落后统计
+type LagStats struct {
+	Lag      time.Duration // 最近一次检测到的落后时长
+	MaxLag   time.Duration // 最大落后时长
+	TotalLag time.Duration // 累计追赶的时长
+	CatchUps uint64        // 追赶次数
+	Missed   uint64        // 累计错过的tick数
+}
+
+// 时间轮节点
 type Task struct {
-	event  func()
-	id     *uint64
-	ttl    int64
-	times  int32
+	owner  *Handle
+	seq    uint32 // 创建时句柄的版本号
 	expire int64
 	next   *Task
 }
@@ -41,96 +87,269 @@ type Wheel struct {
 }
 
 type Timer struct {
+	clock     IClock
+	startAt   time.Time // 启动时刻, 用于计算单调流逝时间
 	startTime int64
 	lastTime  int64
 	caches    []*Task
 	wheels    []*Wheel
 	head      *Wheel
 	tail      *Wheel
+	overflow  taskHeap // 超出时间轮范围的任务
 	tasks     *async.Queue[*Task]
+	buffer    []*Task
 	notify    chan struct{}
+	snaps     chan chan *Snapshot // 快照请求
 	exit      chan struct{}
+	over      chan struct{} // 时间轮协程退出
+	closeOnce sync.Once
+	status    int32      // 1表示已关闭
+	remains   []TaskInfo // 关闭时未触发的任务
+	policy    int32      // 追赶策略
+	round     uint64     // 追赶轮次, 仅在时间轮协程中访问
+	lag       int64      // 最近一次落后时长(ms)
+	maxLag    int64      // 最大落后时长(ms)
+	totalLag  int64      // 累计追赶时长(ms)
+	catchUps  uint64     // 追赶次数
+	missed    uint64     // 累计错过的tick数
+	maxFires  int32      // 每个tick最多触发的任务数, <=0不限制
+	fires     int32      // 当前tick已触发的任务数, 仅在时间轮协程中访问
+	deferred  uint64     // 因限流推迟到下个tick的次数
+	goid      uint64     // 时间轮协程id, 用于识别回调中的调用
+	pending   *Task      // 本tick取出但尚未处理的任务, 仅在时间轮协程中访问
+	firing    *Task      // 正在执行回调的任务, 仅在时间轮协程中访问
 }
 
 func NewTimer(tick int64, size int) *Timer {
-	nowMs := time.Now().UnixMilli()
+	return NewTimerWithClock(RealClock{}, tick, size)
+}
+
+// 使用指定时钟创建定时器, 测试中可传入FakeClock
+// tick为精度(1<<tick毫秒), size为时间轮层数, 第一层12位, 其余每层5位
+func NewTimerWithClock(clock IClock, tick int64, size int) *Timer {
+	layout := make([]int, size)
+	for i := range layout {
+		layout[i] = util.Or(i == 0, 12, 5)
+	}
+	return newTimer(clock, tick, layout)
+}
+
+func newTimer(clock IClock, tick int64, layout []int) *Timer {
+	now := clock.Now()
+	nowMs := now.UnixMilli()
 	wls := []*Wheel{}
-	for i := 0; i < size; i++ {
-		bit := util.Or[int64](i == 0, 12, 5)
-		wls = append(wls, &Wheel{mask: 1<<bit - 1, shift: tick, cursor: nowMs, buckets: make([]*Task, 1<<int(bit))})
-		tick += bit
+	for _, bit := range layout {
+		wls = append(wls, &Wheel{mask: 1<<bit - 1, shift: tick, cursor: nowMs, buckets: make([]*Task, 1<<bit)})
+		tick += int64(bit)
 	}
 	ret := &Timer{
+		clock:     clock,
+		startAt:   now,
 		startTime: nowMs,
 		lastTime:  nowMs,
 		wheels:    wls,
 		head:      wls[0],
-		tail:      wls[size-1],
+		tail:      wls[len(wls)-1],
 		tasks:     async.NewQueue[*Task](),
 		notify:    make(chan struct{}, 1),
+		snaps:     make(chan chan *Snapshot),
 		exit:      make(chan struct{}),
+		over:      make(chan struct{}),
 	}
-	go ret.run()
+	// 在启动协程前创建ticker, 保证模拟时钟推进时不会丢tick
+	go ret.run(clock.NewTicker(time.Duration(int64(1)<<ret.head.shift) * time.Millisecond))
 	return ret
 }
 
-// 注册定时器
-func (d *Timer) Register(taskId *uint64, ttl time.Duration, times int32, f func()) error {
+// 注册定时器, times<0表示无限次
+func (d *Timer) Register(ttl time.Duration, times int32, f func()) (*Handle, error) {
+	return d.RegisterOn(nil, ttl, times, f)
+}
+
+// 注册定时器, 到期后回调投递到e上执行, 避免阻塞时间轮且与e的状态无竞争
+func (d *Timer) RegisterOn(e IExecutor, ttl time.Duration, times int32, f func()) (*Handle, error) {
+	return d.RegisterWith(e, nil, ttl, times, f)
+}
+
+// 按间隔策略注册定时器, s为nil表示固定间隔
+func (d *Timer) RegisterWith(e IExecutor, s IStrategy, ttl time.Duration, times int32, f func()) (*Handle, error) {
+	if atomic.LoadInt32(&d.status) > 0 {
+		return nil, ErrClosed
+	}
+	tt, err := d.check(ttl)
+	if err != nil {
+		return nil, err
+	}
+	ret := &Handle{timer: d, exec: e, event: f, ttl: tt, times: times, strategy: s}
+	d.push(ret, 0, ret.interval())
+	return ret, nil
+}
+
+func (d *Timer) check(ttl time.Duration) (int64, error) {
 	tt := int64(ttl / time.Millisecond)
 	if tt>>d.head.shift <= 0 {
-		return uerror.New(-1, "最小时间间隔必须大于%dms", 1<<d.head.shift)
-	}
-	if (tt >> d.tail.shift) > d.tail.mask {
-		return fmt.Errorf("最大时间间隔必须小于%dms", 1<<d.tail.shift)
+		return 0, uerror.New(-1, "最小时间间隔必须大于%dms", 1<<d.head.shift)
 	}
-	d.tasks.Push(&Task{
-		event: f,
-		id:    taskId,
-		ttl:   tt,
-		times: times,
-	})
+	return tt, nil
+}
+
+// 不小于一个tick的间隔
+func (d *Timer) minTTL(ttl time.Duration) time.Duration {
+	return max(ttl, time.Duration(int64(1)<<d.head.shift)*time.Millisecond)
+}
+
+// 以句柄当前版本生成节点投递到时间轮协程, delay为首次触发的延迟(ms)
+func (d *Timer) push(h *Handle, seq uint32, delay int64) {
+	atomic.StoreInt64(&h.expire, atomic.LoadInt64(&d.lastTime)+delay)
+	d.tasks.Push(&Task{owner: h, seq: seq, expire: delay})
 	select {
 	case d.notify <- struct{}{}:
 	default:
 	}
-	return nil
 }
 
-func (d *Timer) Close() {
-	close(d.exit)
+// 关闭定时器, 取消并返回所有未触发的任务, 可重复调用
+// 在时间轮协程执行的回调中调用时不等待协程退出, 返回当前未触发的任务, 本tick剩余的任务不再触发
+func (d *Timer) Close() []TaskInfo {
+	d.closeOnce.Do(func() {
+		atomic.StoreInt32(&d.status, 1)
+		close(d.exit)
+	})
+	if d.inLoop() {
+		return d.snapshot().Tasks
+	}
+	<-d.over
+	return d.remains
+}
+
+// 时间轮能容纳的最大时长, 超出的任务进入溢出堆
+func (d *Timer) Range() time.Duration {
+	return time.Duration(int64(1)<<(d.tail.shift+int64(bits.Len64(uint64(d.tail.mask))))) * time.Millisecond
+}
+
+// 设置落后于挂钟时的追赶策略, 可在运行时调用
+func (d *Timer) SetCatchUp(policy int32) {
+	atomic.StoreInt32(&d.policy, policy)
 }
 
-func (d *Timer) run() {
-	tick := int64(1 << d.wheels[0].shift)
-	tt := time.NewTicker(time.Duration(tick) * time.Millisecond)
-	defer tt.Stop()
+// 设置每个tick最多触发的任务数, 超出的任务推迟到下个tick, 用于平滑突发, <=0不限制
+func (d *Timer) SetMaxFires(count int32) {
+	atomic.StoreInt32(&d.maxFires, count)
+}
+
+// 因限流推迟到下个tick的次数
+func (d *Timer) GetDeferred() uint64 {
+	return atomic.LoadUint64(&d.deferred)
+}
+
+func (d *Timer) GetLagStats() LagStats {
+	return LagStats{
+		Lag:      time.Duration(atomic.LoadInt64(&d.lag)) * time.Millisecond,
+		MaxLag:   time.Duration(atomic.LoadInt64(&d.maxLag)) * time.Millisecond,
+		TotalLag: time.Duration(atomic.LoadInt64(&d.totalLag)) * time.Millisecond,
+		CatchUps: atomic.LoadUint64(&d.catchUps),
+		Missed:   atomic.LoadUint64(&d.missed),
+	}
+}
+
+func (d *Timer) run(tt ITicker) {
+	atomic.StoreUint64(&d.goid, util.GetGoId())
+	defer func() {
+		tt.Stop()
+		d.remains = d.drain()
+		close(d.over)
+	}()
 	for {
 		select {
 		case <-d.notify:
-			nowMs := atomic.LoadInt64(&d.lastTime)
-			for tt := d.tasks.Pop(); tt != nil; tt = d.tasks.Pop() {
-				tt.expire = nowMs + tt.ttl
-				d.insert(tt)
-			}
+			d.accept()
 			d.flush()
-		case <-tt.C:
-			nowMs := atomic.AddInt64(&d.lastTime, tick)
-			d.update(nowMs)
+		case <-tt.C():
+			// 先接收新注册的任务, 保证注册先于时间推进
+			d.accept()
 			d.flush()
+			d.advance()
+			tt.Done()
+		case ch := <-d.snaps:
+			ch <- d.snapshot()
 		case <-d.exit:
 			return
 		}
 	}
 }
 
-func (d *Timer) update(nowMs int64) {
+// 按挂钟推进时间轮, 落后超过一个tick时按策略追赶错过的tick
+func (d *Timer) advance() {
+	tick := int64(1) << d.head.shift
+	// 使用单调时间, 不受系统时间调整影响
+	nowMs := d.startTime + d.clock.Now().Sub(d.startAt).Milliseconds()
+	missed := (nowMs-atomic.LoadInt64(&d.lastTime))/tick - 1
+	if missed <= 0 {
+		atomic.StoreInt64(&d.lag, 0)
+		d.step(tick, CATCHUP_ALL)
+		return
+	}
+
+	lag := missed * tick
+	atomic.StoreInt64(&d.lag, lag)
+	if lag > atomic.LoadInt64(&d.maxLag) {
+		atomic.StoreInt64(&d.maxLag, lag)
+	}
+	atomic.AddInt64(&d.totalLag, lag)
+	atomic.AddUint64(&d.catchUps, 1)
+	atomic.AddUint64(&d.missed, uint64(missed))
+
+	d.round++
+	policy := atomic.LoadInt32(&d.policy)
+	for ; missed > 0; missed-- {
+		d.step(tick, policy)
+	}
+	// 当前tick正常触发, 合并模式下与错过的tick算作同一次
+	d.step(tick, util.Or[int32](policy == CATCHUP_COALESCE, CATCHUP_COALESCE, CATCHUP_ALL))
+}
+
+func (d *Timer) step(tick int64, mode int32) {
+	nowMs := atomic.AddInt64(&d.lastTime, tick)
+	d.fires = 0
+	d.update(nowMs, mode)
+	d.cascade()
+	d.flush()
+}
+
+// 接收新注册的任务
+func (d *Timer) accept() {
+	nowMs := atomic.LoadInt64(&d.lastTime)
+	d.buffer = d.tasks.Drain(d.buffer[:0])
+	for i, tt := range d.buffer {
+		// 投递时expire为相对延迟
+		tt.expire += nowMs
+		atomic.StoreInt64(&tt.owner.expire, tt.expire)
+		d.insert(tt)
+		d.buffer[i] = nil
+	}
+}
+
+func (d *Timer) update(nowMs int64, mode int32) {
+	limit := atomic.LoadInt32(&d.maxFires)
 	for _, w := range d.wheels {
 		tasks := w.Get(nowMs)
 		for tt := tasks; tt != nil; tt = tasks {
 			tasks = tasks.next
 			tt.next = nil
-			if d.wheels[0].IsExpire(tt) {
-				tt.Handle(nowMs)
+			if d.wheels[0].IsExpire(tt) && atomic.LoadInt32(&d.status) == 0 {
+				if limit > 0 && d.fires >= limit && tt.IsEnable() {
+					// 超出限流, 推迟到下个tick
+					tt.expire = nowMs + int64(1)<<d.head.shift
+					atomic.StoreInt64(&tt.owner.expire, tt.expire)
+					atomic.AddUint64(&d.deferred, 1)
+				} else {
+					// 回调中可能生成快照, 记录不在时间轮中的任务
+					d.pending, d.firing = tasks, tt
+					if tt.Handle(nowMs, mode, d.round) {
+						d.fires++
+					}
+					d.pending, d.firing = nil, nil
+				}
 			}
 			if tt.IsEnable() {
 				d.insert(tt)
@@ -164,10 +383,38 @@ func (d *Timer) flush() {
 				break
 			}
 		}
+		for ; pos < lnews; pos++ {
+			heap.Push(&d.overflow, d.caches[pos])
+		}
+		clear(d.caches)
 		d.caches = d.caches[:0]
 	}
 }
 
+// 溢出任务进入时间轮范围后转入时间轮
+func (d *Timer) cascade() {
+	for d.overflow.Len() > 0 && d.tail.IsMatch(d.overflow[0]) {
+		if tt := heap.Pop(&d.overflow).(*Task); tt.IsEnable() {
+			d.insert(tt)
+		}
+	}
+}
+
+// 按到期时间排序的小顶堆
+type taskHeap []*Task
+
+func (h taskHeap) Len() int           { return len(h) }
+func (h taskHeap) Less(i, j int) bool { return h[i].expire < h[j].expire }
+func (h taskHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *taskHeap) Push(x any)        { *h = append(*h, x.(*Task)) }
+func (h *taskHeap) Pop() any {
+	old := *h
+	tt := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return tt
+}
+
 // 是否进位
 func (w *Wheel) IsCarry() bool {
 	return (w.cursor>>w.shift)&w.mask <= 0
@@ -201,18 +448,27 @@ func (w *Wheel) Get(nowMs int64) *Task {
 
 // 任务是否有效
 func (d *Task) IsEnable() bool {
-	return d.id != nil && *d.id > 0 && d.times != 0
+	return d.owner.isEnable(d.seq)
 }
 
-// 执行任务
-func (d *Task) Handle(nowMs int64) {
-	if d.IsEnable() {
-		async.Recover(d.event)
-		if d.times > 0 {
-			d.times--
-		}
-		if d.times != 0 {
-			d.expire = nowMs + d.ttl
+// 执行任务, mode为追赶策略, round为追赶轮次, 返回是否触发了回调
+func (d *Task) Handle(nowMs int64, mode int32, round uint64) (fired bool) {
+	if !d.IsEnable() {
+		return
+	}
+	switch {
+	case mode == CATCHUP_COALESCE && d.owner.round == round:
+		// 本轮追赶已触发过
+	case mode == CATCHUP_SKIP && atomic.LoadInt32(&d.owner.times) != 1:
+		// 丢弃周期任务错过的触发
+	default:
+		fired = true
+		d.owner.round = round
+		if !d.owner.fire() {
+			return
 		}
 	}
+	d.expire = nowMs + d.owner.interval()
+	atomic.StoreInt64(&d.owner.expire, d.expire)
+	return
 }
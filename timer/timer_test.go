@@ -9,19 +9,596 @@ import (
 	"github.com/hechh/library/mlog"
 )
 
+func newFakeTimer(tick int64, size int) (*Timer, *FakeClock) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		loc = time.UTC
+	}
+	clock := NewFakeClock(time.Date(2026, 10, 18, 10, 0, 0, 0, loc))
+	return NewTimerWithClock(clock, tick, size), clock
+}
+
 func TestTimer(t *testing.T) {
 	async.Except(mlog.Infof)
-	timer := NewTimer(4, 5)
-	taskId := uint64(123)
+	timer, clock := newFakeTimer(4, 5)
+	defer timer.Close()
+	rets := []string{}
+	start := clock.Now()
 	for i := 0; i < 2; i++ {
-		err := timer.Register(&taskId, 1*time.Second, -1, func() {
-			fmt.Println("-->", i, time.Now().Unix())
+		_, err := timer.Register(1*time.Second, -1, func() {
+			rets = append(rets, fmt.Sprintf("%d:%d", i, clock.Now().Sub(start).Round(time.Second)/time.Second))
 		})
 		if err != nil {
-			t.Log("Register failed", err)
-			return
+			t.Fatal("Register failed", err)
+		}
+	}
+	clock.Advance(3 * time.Second)
+	// 同一个桶内的任务触发顺序不保证
+	if len(rets) != 6 || rets[0][2:] != "1" || rets[1][2:] != "1" || rets[5][2:] != "3" {
+		t.Fatalf("rets: %v", rets)
+	}
+}
+
+func TestHandle(t *testing.T) {
+	timer, clock := newFakeTimer(4, 5)
+	defer timer.Close()
+	count := 0
+	hh, err := timer.Register(50*time.Millisecond, 3, func() { count++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr := hh.Remaining(); rr != 50*time.Millisecond {
+		t.Fatalf("remaining: %v", rr)
+	}
+	clock.Advance(32 * time.Millisecond)
+	if rr := hh.Remaining(); rr != 18*time.Millisecond {
+		t.Fatalf("remaining: %v", rr)
+	}
+	clock.Advance(300 * time.Millisecond)
+	if hh.GetFired() != 3 || count != 3 || hh.IsActive() {
+		t.Fatalf("fired: %d, count: %d", hh.GetFired(), count)
+	}
+
+	cc, _ := timer.Register(50*time.Millisecond, -1, func() { t.Error("canceled task fired") })
+	cc.Cancel()
+	if cc.Reset(time.Second) == nil {
+		t.Fatal("expect reset failed after cancel")
+	}
+	clock.Advance(100 * time.Millisecond)
+
+	rr, _ := timer.Register(50*time.Millisecond, 1, func() { count++ })
+	rr.Reset(200 * time.Millisecond)
+	clock.Advance(120 * time.Millisecond)
+	if rr.GetFired() != 0 {
+		t.Fatal("expect reset delay")
+	}
+	clock.Advance(100 * time.Millisecond)
+	if rr.GetFired() != 1 {
+		t.Fatalf("fired: %d", rr.GetFired())
+	}
+}
+
+func TestOrder(t *testing.T) {
+	timer, clock := newFakeTimer(4, 5)
+	defer timer.Close()
+	rets := []int{}
+	for _, ms := range []int{300, 100, 200, 5000, 70000} {
+		timer.Register(time.Duration(ms)*time.Millisecond, 1, func() { rets = append(rets, ms) })
+	}
+	clock.Advance(250 * time.Millisecond)
+	if fmt.Sprint(rets) != "[100 200]" {
+		t.Fatalf("rets: %v", rets)
+	}
+	clock.Advance(80 * time.Second)
+	if fmt.Sprint(rets) != "[100 200 300 5000 70000]" {
+		t.Fatalf("rets: %v", rets)
+	}
+}
+
+func TestRegisterOn(t *testing.T) {
+	timer, clock := newFakeTimer(4, 5)
+	defer timer.Close()
+	aa := async.NewAsync()
+	aa.SetId(7)
+	aa.Start()
+	rets := make(chan uint64, 1)
+	timer.RegisterOn(aa, 20*time.Millisecond, 1, func() {
+		// 在aa上执行, 可以直接访问aa的状态
+		rets <- aa.GetId()
+	})
+	clock.Advance(32 * time.Millisecond)
+	select {
+	case id := <-rets:
+		if id != 7 {
+			t.Fatalf("id: %d", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+	aa.Done()
+	aa.Wait()
+}
+
+func TestParseCron(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	cases := []struct {
+		spec   string
+		from   string
+		expect string
+	}{
+		{"0 5 * * MON", "2026-10-18 10:00:00", "2026-10-19 05:00:00 -0400"},
+		{"@daily", "2026-10-18 10:00:00", "2026-10-19 00:00:00 -0400"},
+		{"*/15 9-10 * * *", "2026-10-18 10:50:00", "2026-10-19 09:00:00 -0400"},
+		{"30 10 1 */3 *", "2026-10-18 10:00:00", "2027-01-01 10:30:00 -0500"},
+		{"0 0 30 2 *", "2026-10-18 10:00:00", ""},
+		// 夏令时跳过的2:30在跳变后的3:00触发, 之后恢复正常
+		{"30 2 * * *", "2026-03-07 12:00:00", "2026-03-08 03:00:00 -0400"},
+		{"30 2 * * *", "2026-03-08 03:00:00", "2026-03-09 02:30:00 -0400"},
+		{"*/20 2 * * *", "2026-03-08 01:50:00", "2026-03-08 03:00:00 -0400"},
+		{"*/20 2 * * *", "2026-03-08 03:00:00", "2026-03-09 02:00:00 -0400"},
+		// 重复的1:30只触发一次
+		{"30 1 * * *", "2026-11-01 01:30:00", "2026-11-02 01:30:00 -0500"},
+		{"0 0 12 1 1 *", "2026-10-18 10:00:00", "2027-01-01 12:00:00 -0500"},
+	}
+	for _, item := range cases {
+		sch, err := ParseCron(item.spec, loc)
+		if err != nil {
+			t.Fatal(item.spec, err)
+		}
+		from, _ := time.ParseInLocation("2006-01-02 15:04:05", item.from, loc)
+		next := sch.Next(from)
+		ret := ""
+		if !next.IsZero() {
+			ret = next.Format("2006-01-02 15:04:05 -0700")
+		}
+		if ret != item.expect {
+			t.Errorf("spec: %s, from: %s, expect: %s, got: %s", item.spec, item.from, item.expect, ret)
+		}
+	}
+	for _, spec := range []string{"* * *", "61 * * * *", "*/0 * * * *", "a * * * *"} {
+		if _, err := ParseCron(spec, loc); err == nil {
+			t.Errorf("expect error: %s", spec)
 		}
 	}
-	time.Sleep(4 * time.Second)
-	//select {}
+}
+
+func TestRegisterCron(t *testing.T) {
+	// 16s精度, 减少模拟推进的tick数
+	timer, clock := newFakeTimer(14, 3)
+	defer timer.Close()
+	rets := []string{}
+	hh, err := timer.RegisterCron("0 5 * * MON", clock.Now().Location(), nil, func() {
+		rets = append(rets, clock.Now().Format("01-02 15:04"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(20 * 24 * time.Hour)
+	// 11-01夏令时结束, 仍在当地时间05:00触发
+	if fmt.Sprint(rets) != "[10-19 05:00 10-26 05:00 11-02 05:00]" {
+		t.Fatalf("rets: %v", rets)
+	}
+	hh.Cancel()
+	clock.Advance(7 * 24 * time.Hour)
+	if hh.GetFired() != 3 {
+		t.Fatal("fired after cancel")
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	// 单层时间轮范围约65s, 超出部分进入溢出堆
+	timer, clock := newFakeTimer(4, 1)
+	defer timer.Close()
+	fired := []time.Time{}
+	start := clock.Now()
+	if _, err := timer.Register(10*time.Minute, 1, func() { fired = append(fired, clock.Now()) }); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(9 * time.Minute)
+	if len(fired) != 0 {
+		t.Fatal("fired too early")
+	}
+	clock.Advance(2 * time.Minute)
+	if len(fired) != 1 || fired[0].Sub(start) < 10*time.Minute || fired[0].Sub(start) > 10*time.Minute+16*time.Millisecond {
+		t.Fatalf("fired: %v", fired)
+	}
+}
+
+func TestCatchUp(t *testing.T) {
+	cases := []struct {
+		policy int32
+		expect string
+	}{
+		{CATCHUP_ALL, "10 1"},
+		{CATCHUP_COALESCE, "1 1"},
+		{CATCHUP_SKIP, "0 1"},
+	}
+	for _, item := range cases {
+		timer, clock := newFakeTimer(4, 5)
+		timer.SetCatchUp(item.policy)
+		periods, onces := 0, 0
+		timer.Register(100*time.Millisecond, -1, func() { periods++ })
+		timer.Register(500*time.Millisecond, 1, func() { onces++ })
+		// 停顿1s, 期间的tick全部丢失
+		clock.Stall(time.Second)
+		if ret := fmt.Sprintf("%d %d", periods, onces); ret != item.expect {
+			t.Errorf("policy: %d, expect: %s, got: %s", item.policy, item.expect, ret)
+		}
+		stats := timer.GetLagStats()
+		if stats.CatchUps != 1 || stats.Missed != 61 || stats.Lag != 976*time.Millisecond || stats.TotalLag != stats.MaxLag {
+			t.Errorf("policy: %d, stats: %+v", item.policy, stats)
+		}
+		// 追赶后恢复正常触发
+		periods = 0
+		clock.Advance(500 * time.Millisecond)
+		if periods < 4 || timer.GetLagStats().Lag != 0 {
+			t.Errorf("policy: %d, periods: %d after catch up", item.policy, periods)
+		}
+		timer.Close()
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	timer, clock := newFakeTimer(4, 5)
+	start := clock.Now()
+	timer.Register(30*time.Second, 1, func() {})
+	hh, _ := timer.Register(100*time.Millisecond, -1, func() {})
+	hh.SetLabel("tick")
+	timer.Register(10*time.Minute, 1, func() {})
+	bb, _ := timer.Register(time.Minute, 1, func() {})
+	bb.SetLabel("build").Reset(30 * time.Second)
+	clock.Advance(time.Second)
+
+	snap, err := timer.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Tasks) != 4 || snap.Wheels[0] != 3 || snap.Wheels[1] != 1 || snap.Overflow != 0 {
+		t.Fatalf("snapshot: %+v", snap)
+	}
+	var build TaskInfo
+	for _, item := range snap.Tasks {
+		if item.Label == "build" {
+			build = item
+		}
+	}
+	if build.Label != "build" || !build.Next.Equal(start.Add(30*time.Second)) || build.Remaining != 29*time.Second || build.Times != 1 {
+		t.Fatalf("build: %+v", build)
+	}
+	data, err := snap.Encode(GobEncoder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	timer.Close()
+	if _, err := timer.Snapshot(); err == nil {
+		t.Fatal("expect snapshot failed after close")
+	}
+
+	// 停机10s后重启
+	snap, err = DecodeSnapshot(GobEncoder{}, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock = NewFakeClock(start.Add(11 * time.Second))
+	timer = NewTimerWithClock(clock, 4, 5)
+	defer timer.Close()
+	fired := map[string]int{}
+	hhs, err := timer.Restore(snap, nil, func(label string) (func(), IStrategy) {
+		if label == "tick" {
+			// 已触发10次, 退避间隔达到上限1s
+			return func() { fired[label]++ }, BackoffStrategy{Factor: 2, Max: time.Second}
+		}
+		return func() { fired[label]++ }, nil
+	})
+	if err != nil || len(hhs) != 2 {
+		t.Fatalf("restore: %d, %v", len(hhs), err)
+	}
+	if hhs[0].GetLabel() != "tick" || hhs[1].GetLabel() != "build" || hhs[1].Remaining() != 19*time.Second {
+		t.Fatalf("remaining: %v", hhs[1].Remaining())
+	}
+	clock.Advance(18 * time.Second)
+	if fired["build"] != 0 || fired["tick"] < 17 || fired["tick"] > 19 {
+		t.Fatalf("fired: %v", fired)
+	}
+	clock.Advance(2 * time.Second)
+	if fired["build"] != 1 || hhs[1].IsActive() {
+		t.Fatalf("fired: %v", fired)
+	}
+
+	// 关闭后不能恢复
+	timer.Close()
+	if _, err := timer.Restore(snap, nil, func(label string) (func(), IStrategy) { return func() {}, nil }); err != ErrClosed {
+		t.Fatalf("expect ErrClosed, got %v", err)
+	}
+}
+
+func TestStrategy(t *testing.T) {
+	timer, clock := newFakeTimer(4, 5)
+	defer timer.Close()
+	start := clock.Now()
+
+	// 抖动打散同时注册的任务
+	jitters := map[time.Duration]int{}
+	for i := 0; i < 100; i++ {
+		timer.RegisterWith(nil, JitterStrategy{Jitter: 200 * time.Millisecond}, time.Second, 1, func() {
+			jitters[clock.Now().Sub(start)]++
+		})
+	}
+	// 指数退避: 100, 200, 400, 800, 1000(上限)
+	backoffs := []time.Duration{}
+	timer.RegisterWith(nil, BackoffStrategy{Factor: 2, Max: time.Second}, 100*time.Millisecond, 5, func() {
+		backoffs = append(backoffs, clock.Now().Sub(start).Round(100*time.Millisecond))
+	})
+	clock.Advance(3 * time.Second)
+
+	count := 0
+	for diff, cnt := range jitters {
+		if diff < 780*time.Millisecond || diff > 1200*time.Millisecond {
+			t.Errorf("jitter out of range: %v", diff)
+		}
+		count += cnt
+	}
+	if count != 100 || len(jitters) < 5 {
+		t.Fatalf("jitter buckets: %d, count: %d", len(jitters), count)
+	}
+	if fmt.Sprint(backoffs) != "[100ms 300ms 700ms 1.5s 2.5s]" {
+		t.Fatalf("backoffs: %v", backoffs)
+	}
+}
+
+func TestMaxFires(t *testing.T) {
+	timer, clock := newFakeTimer(4, 5)
+	defer timer.Close()
+	timer.SetMaxFires(10)
+	count := 0
+	for i := 0; i < 35; i++ {
+		timer.Register(100*time.Millisecond, 1, func() { count++ })
+	}
+	for _, expect := range []int{10, 20, 30, 35} {
+		clock.Advance(16 * time.Millisecond)
+		for count == 0 {
+			clock.Advance(16 * time.Millisecond)
+		}
+		if count != expect {
+			t.Fatalf("expect: %d, count: %d", expect, count)
+		}
+	}
+	if timer.GetDeferred() != 25+15+5 {
+		t.Fatalf("deferred: %d", timer.GetDeferred())
+	}
+}
+
+func TestConfig(t *testing.T) {
+	for _, cfg := range []Config{
+		{Tick: 10 * time.Millisecond},
+		{Tick: 1500 * time.Microsecond},
+		{Wheels: []int{12, 0}},
+		{Wheels: []int{16, 16, 16}},
+		{Tick: time.Millisecond, Wheels: []int{10}, MaxTTL: 2 * time.Second},
+	} {
+		if _, err := NewTimerWithConfig(cfg); err == nil {
+			t.Errorf("expect error: %+v", cfg)
+		}
+	}
+
+	clock := NewFakeClock(time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC))
+	timer, err := NewTimerWithConfig(Config{Tick: 8 * time.Millisecond, Wheels: []int{10, 6}, MaxTTL: 5 * time.Minute, Clock: clock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timer.Range() != time.Duration(8<<16)*time.Millisecond {
+		t.Fatalf("range: %v", timer.Range())
+	}
+	if _, err := timer.Register(4*time.Millisecond, 1, func() {}); err == nil {
+		t.Fatal("expect ttl less than tick failed")
+	}
+	count := 0
+	timer.Register(10*time.Millisecond, 1, func() { count++ })
+	hh, _ := timer.Register(time.Minute, -1, func() { count++ })
+	hh.SetLabel("remain")
+	timer.Register(2*time.Hour, 1, func() { count++ })
+	clock.Advance(16 * time.Millisecond)
+
+	remains := timer.Close()
+	if count != 1 || len(remains) != 2 || remains[0].Label != "remain" || remains[1].Wheel != -1 || hh.IsActive() {
+		t.Fatalf("count: %d, remains: %+v", count, remains)
+	}
+	if len(timer.Close()) != 2 {
+		t.Fatal("expect same remains")
+	}
+	if _, err := timer.Register(time.Second, 1, func() {}); err == nil {
+		t.Fatal("expect register failed after close")
+	}
+
+	// 替换全局定时器
+	timer, _ = NewTimerWithConfig(Config{Clock: clock})
+	old := SetDefault(timer)
+	defer SetDefault(old)
+	defer timer.Close()
+	Register(time.Second, 1, func() { count++ })
+	clock.Advance(time.Second)
+	if count != 2 {
+		t.Fatalf("count: %d", count)
+	}
+}
+
+func TestDebouncer(t *testing.T) {
+	timer, clock := newFakeTimer(4, 5)
+	defer timer.Close()
+	count := 0
+	dd := NewDebouncer(timer, 100*time.Millisecond, func() { count++ })
+	for i := 0; i < 5; i++ {
+		dd.Call()
+		clock.Advance(50 * time.Millisecond)
+	}
+	if count != 0 {
+		t.Fatalf("count: %d", count)
+	}
+	clock.Advance(80 * time.Millisecond)
+	if count != 1 {
+		t.Fatalf("count: %d", count)
+	}
+
+	// 首次立即执行, 末尾再执行一次
+	count = 0
+	dd = NewDebouncer(timer, 100*time.Millisecond, func() { count++ })
+	dd.SetEdge(true, true)
+	dd.Call()
+	if count != 1 {
+		t.Fatalf("leading count: %d", count)
+	}
+	dd.Call()
+	clock.Advance(150 * time.Millisecond)
+	if count != 2 {
+		t.Fatalf("trailing count: %d", count)
+	}
+	dd.Call()
+	dd.Cancel()
+	clock.Advance(150 * time.Millisecond)
+	if count != 3 {
+		t.Fatalf("canceled count: %d", count)
+	}
+
+	// 持续调用时每200ms至少执行一次
+	count = 0
+	dd = NewDebouncer(timer, 100*time.Millisecond, func() { count++ })
+	dd.SetMaxWait(200 * time.Millisecond)
+	for i := 0; i < 20; i++ {
+		dd.Call()
+		clock.Advance(50 * time.Millisecond)
+	}
+	if count < 4 || count > 5 {
+		t.Fatalf("max wait count: %d", count)
+	}
+	dd.Call()
+	last := count
+	dd.Flush()
+	clock.Advance(300 * time.Millisecond)
+	if count != last+1 {
+		t.Fatalf("flush count: %d, last: %d", count, last)
+	}
+}
+
+func TestThrottler(t *testing.T) {
+	timer, clock := newFakeTimer(4, 5)
+	defer timer.Close()
+	count := 0
+	tt := NewThrottler(timer, 100*time.Millisecond, func() { count++ })
+	for i := 0; i < 100; i++ {
+		tt.Call()
+		clock.Advance(10 * time.Millisecond)
+	}
+	if count < 10 || count > 11 {
+		t.Fatalf("count: %d", count)
+	}
+	clock.Advance(300 * time.Millisecond)
+	last := count
+	clock.Advance(300 * time.Millisecond)
+	if count != last {
+		t.Fatalf("count: %d, last: %d", count, last)
+	}
+
+	// 只在窗口末尾执行
+	count = 0
+	tt = NewThrottler(timer, 100*time.Millisecond, func() { count++ })
+	tt.SetEdge(false, true)
+	tt.Call()
+	tt.Call()
+	if count != 0 {
+		t.Fatalf("count: %d", count)
+	}
+	clock.Advance(120 * time.Millisecond)
+	if count != 1 {
+		t.Fatalf("count: %d", count)
+	}
+}
+
+func TestCronCancelInCallback(t *testing.T) {
+	timer, clock := newFakeTimer(4, 5)
+	defer timer.Close()
+	var hh *CronHandle
+	count := 0
+	hh, err := timer.RegisterCron("* * * * * *", nil, nil, func() {
+		count++
+		hh.Next()
+		hh.Cancel()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		clock.Advance(5 * time.Second)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("deadlock")
+	}
+	if count != 1 || hh.GetFired() != 1 {
+		t.Fatalf("count: %d, fired: %d", count, hh.GetFired())
+	}
+}
+
+func TestSnapshotInCallback(t *testing.T) {
+	timer, clock := newFakeTimer(4, 5)
+	defer timer.Close()
+	timer.Register(time.Minute, 1, func() {})
+	var snap *Snapshot
+	var err error
+	hh, _ := timer.Register(100*time.Millisecond, 3, func() {
+		if snap == nil {
+			snap, err = timer.Snapshot()
+		}
+	})
+	hh.SetLabel("persist")
+	done := make(chan struct{})
+	go func() {
+		clock.Advance(time.Second)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("deadlock")
+	}
+	if err != nil || len(snap.Tasks) != 2 {
+		t.Fatalf("snapshot: %+v, %v", snap, err)
+	}
+	// 正在执行的任务按触发后的状态记录
+	item := snap.Tasks[0]
+	if item.Label != "persist" || item.Times != 2 || item.Fired != 1 || item.Remaining != 100*time.Millisecond {
+		t.Fatalf("item: %+v", item)
+	}
+}
+
+func TestCloseInCallback(t *testing.T) {
+	timer, clock := newFakeTimer(4, 5)
+	timer.Register(time.Minute, 1, func() {})
+	var remains []TaskInfo
+	count := 0
+	timer.Register(100*time.Millisecond, -1, func() {
+		count++
+		remains = timer.Close()
+	})
+	done := make(chan struct{})
+	go func() {
+		clock.Advance(time.Second)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("deadlock")
+	}
+	if count != 1 || len(remains) != 2 {
+		t.Fatalf("count: %d, remains: %+v", count, remains)
+	}
+	if len(timer.Close()) != 2 {
+		t.Fatal("expect remains after close")
+	}
 }
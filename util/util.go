@@ -1,9 +1,12 @@
 package util
 
 import (
+	"bytes"
 	"os"
 	"os/signal"
 	"reflect"
+	"runtime"
+	"strconv"
 	"syscall"
 	"time"
 	"unsafe"
@@ -27,6 +30,18 @@ func BytesToString(bts []byte) string {
 	return *(*string)(unsafe.Pointer(s))
 }
 
+// 当前协程id, 解析runtime.Stack的首行"goroutine 123 [running]:", 开销较大, 不要在热路径调用
+func GetGoId() uint64 {
+	var buf [64]byte
+	line := buf[:runtime.Stack(buf[:], false)]
+	line = bytes.TrimPrefix(line, []byte("goroutine "))
+	if pos := bytes.IndexByte(line, ' '); pos > 0 {
+		line = line[:pos]
+	}
+	id, _ := strconv.ParseUint(string(line), 10, 64)
+	return id
+}
+
 func Retry(attempts int, sleep time.Duration, f func() error) (err error) {
 	for i := 0; i < attempts; i++ {
 		if err = f(); err == nil {